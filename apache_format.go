@@ -0,0 +1,264 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ApacheCombinedFormat is the LogFormat Apache's default configuration calls
+// "combined".
+const ApacheCombinedFormat = `%h %l %u %t "%r" %>s %b "%{Referer}i" "%{User-agent}i"`
+
+// ApacheVhostCombinedFormat is the LogFormat Apache's Debian packaging calls
+// "vhost_combined", which starts with the virtual host each request was for.
+const ApacheVhostCombinedFormat = `%v:%p %h %l %u %t "%r" %>s %O "%{Referer}i" "%{User-Agent}i"`
+
+// apacheDirective matches a % directive with its optional status conditions,
+// < or > modifier and {parameter}.
+var apacheDirective = regexp.MustCompile(`%!?[0-9,]*([<>]?)(?:\{([^}]*)\})?([a-zA-Z%])`)
+
+var apacheFields = map[string]recordField{
+	"h":            fieldClient,
+	"a":            fieldClient,
+	"t":            fieldTimeCLF,
+	"t:sec":        fieldTimeEpoch,
+	"t:msec":       fieldTimeEpochMillis,
+	"t:usec":       fieldTimeEpochMicros,
+	"r":            fieldRequest,
+	"m":            fieldMethod,
+	"U":            fieldURI,
+	">s":           fieldStatus,
+	"s":            fieldStatusOriginal,
+	"b":            fieldBytes,
+	"B":            fieldBytes,
+	"O":            fieldBytesTotal,
+	"D":            fieldDurationMicros,
+	"T":            fieldDurationSeconds,
+	"T:s":          fieldDurationSeconds,
+	"T:ms":         fieldDurationMillis,
+	"T:us":         fieldDurationMicros,
+	"i:host":       fieldHost,
+	"V":            fieldHostHeader,
+	"v":            fieldServerName,
+	"i:referer":    fieldReferer,
+	"i:user-agent": fieldUserAgent,
+}
+
+// apachePatterns match directives that are commonly logged back to back, such
+// as "%U%q", where a lazy match would leave the first one empty.
+var apachePatterns = map[string]string{
+	"U": `([^?\s]*)`,
+}
+
+// ApacheParser parses lines written by Apache httpd with a given LogFormat.
+// Directives with a counterpart in AccessRecord are mapped onto it. The rest
+// are kept in Extra, keyed by their letter and any parameter: "%{X-Trace}i"
+// as "i:x-trace", "%{session}C" as "C:session" and "%P" as "P".
+type ApacheParser struct {
+	name        string
+	keys        []string
+	timeLayouts map[string]string // Go layouts for %{strftime format}t keys
+	re          *regexp.Regexp
+}
+
+// CompileApacheFormat compiles the format string of a LogFormat directive.
+func CompileApacheFormat(name string, format string) (*ApacheParser, error) {
+	p := &ApacheParser{name: name, timeLayouts: make(map[string]string)}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	locs := apacheDirective.FindAllStringSubmatchIndex(format, -1)
+	last := 0
+	for i, loc := range locs {
+		literal := format[last:loc[0]]
+		last = loc[1]
+		letter := format[loc[6]:loc[7]]
+		if letter == "%" {
+			expr.WriteString(regexp.QuoteMeta(literal + "%"))
+			continue
+		}
+		expr.WriteString(regexp.QuoteMeta(literal))
+
+		key, err := p.directiveKey(format, loc)
+		if err != nil {
+			return nil, err
+		}
+		p.keys = append(p.keys, key)
+
+		next := format[loc[1]:]
+		if i+1 < len(locs) {
+			next = format[loc[1]:locs[i+1][0]]
+		}
+		if pattern, ok := apachePatterns[key]; ok {
+			expr.WriteString(pattern)
+		} else if strings.HasSuffix(literal, `"`) && strings.HasPrefix(next, `"`) {
+			// Quotes inside quoted values are escaped by Apache.
+			expr.WriteString(`((?:[^"\\]|\\.)*)`)
+		} else {
+			expr.WriteString("(.*?)")
+		}
+	}
+	expr.WriteString(regexp.QuoteMeta(format[last:]))
+	expr.WriteString("$")
+	if len(p.keys) == 0 {
+		return nil, errors.New("The LogFormat " + name + " has no directives!")
+	}
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+	return p, nil
+}
+
+// directiveKey names the directive at loc, as used in apacheFields and Extra.
+func (p *ApacheParser) directiveKey(format string, loc []int) (string, error) {
+	modifier := format[loc[2]:loc[3]]
+	letter := format[loc[6]:loc[7]]
+	if letter == "s" && modifier == ">" {
+		return ">s", nil
+	}
+	if loc[4] < 0 {
+		return letter, nil
+	}
+
+	param := format[loc[4]:loc[5]]
+	switch letter {
+	case "i", "o":
+		param = strings.ToLower(param)
+	case "t":
+		param = strings.TrimPrefix(strings.TrimPrefix(param, "begin:"), "end:")
+		if _, ok := apacheFields["t:"+param]; !ok && !strings.Contains(param, "frac") {
+			layout, err := strftimeLayout(param)
+			if err != nil {
+				return "", err
+			}
+			p.timeLayouts["t:"+param] = layout
+		}
+	}
+	return letter + ":" + param, nil
+}
+
+// Name implements Parser.
+func (p *ApacheParser) Name() string {
+	return "apache:" + p.name
+}
+
+// Parse implements Parser.
+func (p *ApacheParser) Parse(line string) (*AccessRecord, error) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("%w: Apache LogFormat %s: %s", ErrFormatMismatch, p.name, line)
+	}
+
+	r := new(AccessRecord)
+	values := make(map[string]string)
+	// Several strftime directives, such as "%{%d/%b/%Y %T}t %{%z}t", make up
+	// one time between them.
+	var layouts, times []string
+	for i, key := range p.keys {
+		v := unescapeApache(m[i+1])
+		if layout, ok := p.timeLayouts[key]; ok {
+			layouts = append(layouts, layout)
+			times = append(times, v)
+			continue
+		}
+		values[key] = v
+	}
+	if len(layouts) > 0 {
+		t, err := time.Parse(strings.Join(layouts, " "), strings.Join(times, " "))
+		if err != nil {
+			return nil, fmt.Errorf("%w %q in log line: %s", ErrInvalidValue, strings.Join(times, " "), err)
+		}
+		r.Time = t
+	}
+	// %U is the path without the query string, which is logged by %q.
+	if _, ok := values["U"]; ok {
+		values["U"] += values["q"]
+		delete(values, "q")
+	}
+
+	if err := fillFromVariables(r, values, apacheFields); err != nil {
+		return nil, err
+	}
+	// %{msec_frac}t and %{usec_frac}t log the fraction of a second %t leaves out.
+	for key, unit := range map[string]time.Duration{"t:msec_frac": time.Millisecond, "t:usec_frac": time.Microsecond} {
+		if frac, ok := values[key]; ok {
+			n, err := strconv.Atoi(frac)
+			if err != nil {
+				return nil, fmt.Errorf("%w %q in log line: %s", ErrInvalidValue, frac, err)
+			}
+			r.Time = r.Time.Add(time.Duration(n) * unit)
+		}
+	}
+	return r, nil
+}
+
+// unescapeApache undoes the escaping Apache applies to quotes, backslashes and
+// unprintable bytes in logged values.
+func unescapeApache(v string) string {
+	if !strings.Contains(v, `\`) {
+		return v
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] != '\\' || i+1 == len(v) {
+			b.WriteByte(v[i])
+			continue
+		}
+		i++
+		switch v[i] {
+		case 'n':
+			b.WriteByte('\n')
+		case 't':
+			b.WriteByte('\t')
+		case 'x':
+			if i+2 < len(v) {
+				if c, err := strconv.ParseUint(v[i+1:i+3], 16, 8); err == nil {
+					b.WriteByte(byte(c))
+					i += 2
+					continue
+				}
+			}
+			b.WriteString(`\x`)
+		default:
+			b.WriteByte(v[i])
+		}
+	}
+	return b.String()
+}
+
+var strftimeVerbs = map[byte]string{
+	'a': "Mon", 'A': "Monday", 'b': "Jan", 'h': "Jan", 'B': "January",
+	'd': "02", 'e': "_2", 'm': "01", 'y': "06", 'Y': "2006",
+	'H': "15", 'I': "03", 'M': "04", 'S': "05", 'p': "PM",
+	'z': "-0700", 'Z': "MST", 'j': "002",
+	'T': "15:04:05", 'D': "01/02/06", 'F': "2006-01-02", '%': "%",
+}
+
+// strftimeLayout converts the strftime format of a %{format}t directive into a
+// time layout for time.Parse.
+func strftimeLayout(format string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' {
+			b.WriteByte(format[i])
+			continue
+		}
+		if i+1 == len(format) {
+			return "", errors.New("Incomplete strftime format " + format)
+		}
+		i++
+		layout, ok := strftimeVerbs[format[i]]
+		if !ok {
+			return "", errors.New("Unsupported strftime conversion %" + string(format[i]))
+		}
+		b.WriteString(layout)
+	}
+	return b.String(), nil
+}
@@ -0,0 +1,132 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCompileApacheFormatCombined(t *testing.T) {
+	p, err := CompileApacheFormat("combined", ApacheCombinedFormat)
+	if err != nil {
+		t.Errorf("Failed to compile the format! %s", err)
+		t.FailNow()
+	}
+	r, err := p.Parse(`127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/apache_pb.gif HTTP/1.0" 200 - "http://www.example.com/start.html" "Agent \"quoted\" \\o/"`)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Time.Unix() != 971211336 || r.Host != "my.site.com" || r.Status != 200 || r.Bytes != 0 {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.UserAgent != `Agent "quoted" \o/` || r.Referer != "http://www.example.com/start.html" {
+		t.Errorf("Unexpected referer %q or user agent %q", r.Referer, r.UserAgent)
+	}
+	if r.Extra["u"] != "frank" || p.Name() != "apache:combined" {
+		t.Errorf("Unexpected extras %v or name %s", r.Extra, p.Name())
+	}
+}
+
+func TestCompileApacheFormatDirectives(t *testing.T) {
+	format := `%a %v %{Host}i [%{%Y-%m-%d %H:%M:%S %z}t] "%m %U%q %H" %s %>s %B %D "%{X-Forwarded-For}i" %{session}C %400,501{Via}i 100%%`
+	p, err := CompileApacheFormat("custom", format)
+	if err != nil {
+		t.Errorf("Failed to compile the format! %s", err)
+		t.FailNow()
+	}
+	r, err := p.Parse(`10.0.0.1 www.site.com my.site.com [2026-10-16 08:00:00 +0000] "GET /pages/view?id=7 HTTP/1.1" 302 200 512 2500 "1.2.3.4, 5.6.7.8" abc - 100%`)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Host != "my.site.com" {
+		t.Errorf("Expected the Host header to win over the server name but got %s", r.Host)
+	}
+	if r.Status != 200 {
+		t.Errorf("Expected the final status 200 but got %d", r.Status)
+	}
+	if r.URL.Path != "/pages/view" || r.URL.RawQuery != "id=7" || r.Method != "GET" {
+		t.Errorf("Unexpected request %s %s", r.Method, r.URL)
+	}
+	if r.Duration != 2500*time.Microsecond || r.Bytes != 512 {
+		t.Errorf("Expected 2.5ms and 512 bytes but got %s and %d", r.Duration, r.Bytes)
+	}
+	if !r.Time.Equal(time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)) {
+		t.Errorf("Unexpected time %s", r.Time)
+	}
+	if r.Extra["i:x-forwarded-for"] != "1.2.3.4, 5.6.7.8" || r.Extra["C:session"] != "abc" || r.Extra["H"] != "HTTP/1.1" {
+		t.Errorf("Unexpected extras %v", r.Extra)
+	}
+}
+
+func TestCompileApacheFormatDurations(t *testing.T) {
+	tests := map[string]time.Duration{
+		"%T":       2 * time.Second,
+		"%{s}T":    2 * time.Second,
+		"%{ms}T":   2 * time.Millisecond,
+		"%{us}T":   2 * time.Microsecond,
+		"%D":       2 * time.Microsecond,
+		"%{msec}t": 0,
+	}
+	for directive, expected := range tests {
+		p, err := CompileApacheFormat("d", `"%r" `+directive)
+		if err != nil {
+			t.Errorf("Failed to compile %s! %s", directive, err)
+			continue
+		}
+		r, err := p.Parse(`"GET http://my.site.com/a HTTP/1.1" 2`)
+		if err != nil {
+			t.Errorf("Failed to parse with %s! %s", directive, err)
+			continue
+		}
+		if r.Duration != expected {
+			t.Errorf("Expected %s from %s but got %s", expected, directive, r.Duration)
+		}
+	}
+}
+
+func TestCompileApacheFormatErrors(t *testing.T) {
+	if _, err := CompileApacheFormat("bad", "no directives"); err == nil {
+		t.Errorf("Expected an error for a format without directives!")
+	}
+	if _, err := CompileApacheFormat("bad", `%h %{%Q}t`); err == nil {
+		t.Errorf("Expected an error for an unsupported strftime conversion!")
+	}
+	p, _ := CompileApacheFormat("combined", ApacheCombinedFormat)
+	if _, err := p.Parse("garbage"); err == nil {
+		t.Errorf("Expected an error for a line that does not match!")
+	}
+}
+
+func TestLogStatsApacheFormat(t *testing.T) {
+	p, _ := CompileApacheFormat("timed", `%h %{Host}i %t "%r" %>s %b %{ms}T`)
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(p)
+	for _, line := range []string{
+		`10.0.0.1 my.site.com [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/a HTTP/1.1" 200 10 4`,
+		`10.0.0.1 my.site.com [10/Oct/2000:13:55:37 -0700] "GET http://my.site.com/pages/b HTTP/1.1" 200 10 2`,
+	} {
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if d := stats.PopularSections()[0].AverageDuration(); d != 3*time.Millisecond {
+		t.Errorf("Expected an average response time of 3ms but got %s", d)
+	}
+}
+
+func TestCompileApacheFormatFractionalTime(t *testing.T) {
+	p, err := CompileApacheFormat("frac", `[%{%d/%b/%Y:%H:%M:%S}t.%{msec_frac}t %{%z}t] "%r"`)
+	if err != nil {
+		t.Errorf("Failed to compile the format! %s", err)
+		t.FailNow()
+	}
+	r, err := p.Parse(`[10/Oct/2000:13:55:36.250 -0700] "GET http://my.site.com/ HTTP/1.1"`)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Time.UnixMilli() != 971211336250 {
+		t.Errorf("Expected the milliseconds to be kept but got %s", r.Time)
+	}
+}
@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// albFieldNames are the fields of an Application Load Balancer log entry in
+// order. Newer fields are added at the end, so entries may have more or fewer.
+var albFieldNames = []string{
+	"type", "time", "elb", "client:port", "target:port",
+	"request_processing_time", "target_processing_time", "response_processing_time",
+	"elb_status_code", "target_status_code", "received_bytes", "sent_bytes",
+	"request", "user_agent", "ssl_cipher", "ssl_protocol", "target_group_arn",
+	"trace_id", "domain_name", "chosen_cert_arn", "matched_rule_priority",
+	"request_creation_time", "actions_executed", "redirect_url", "error_reason",
+	"target:port_list", "target_status_code_list", "classification",
+	"classification_reason", "conn_trace_id",
+}
+
+// elbFieldNames are the fields of a Classic Load Balancer log entry in order.
+var elbFieldNames = []string{
+	"time", "elb", "client:port", "backend:port",
+	"request_processing_time", "backend_processing_time", "response_processing_time",
+	"elb_status_code", "backend_status_code", "received_bytes", "sent_bytes",
+	"request", "user_agent", "ssl_cipher", "ssl_protocol",
+}
+
+var loadBalancerFields = map[string]recordField{
+	"time":            fieldTimeISO8601,
+	"client":          fieldClient,
+	"request":         fieldRequest,
+	"elb_status_code": fieldStatus,
+	"sent_bytes":      fieldBytes,
+	"user_agent":      fieldUserAgent,
+}
+
+// ALBParser parses AWS Application Load Balancer access logs. The status is the
+// load balancer's, and the duration is the sum of the request, target and
+// response processing times that were recorded. Every other field, including
+// each processing time, is kept in Extra under its name in the AWS docs.
+type ALBParser struct{}
+
+// Name implements Parser.
+func (ALBParser) Name() string {
+	return "alb"
+}
+
+// Parse implements Parser.
+func (ALBParser) Parse(line string) (*AccessRecord, error) {
+	return parseLoadBalancer(line, albFieldNames, 16, "target_processing_time")
+}
+
+// ELBParser parses AWS Classic Load Balancer access logs in the same way as
+// ALBParser. Its backend is called the target in ALB logs.
+type ELBParser struct{}
+
+// Name implements Parser.
+func (ELBParser) Name() string {
+	return "elb"
+}
+
+// Parse implements Parser.
+func (ELBParser) Parse(line string) (*AccessRecord, error) {
+	return parseLoadBalancer(line, elbFieldNames, 13, "backend_processing_time")
+}
+
+// parseLoadBalancer parses a load balancer log line with at least minFields of
+// the given fields.
+func parseLoadBalancer(line string, names []string, minFields int, targetTime string) (*AccessRecord, error) {
+	fields, err := splitLogFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) < minFields {
+		return nil, fmt.Errorf("%w: too few in load balancer log line: %s", ErrFieldCount, line)
+	}
+
+	values := make(map[string]string)
+	for i, name := range names {
+		if i < len(fields) {
+			values[name] = fields[i]
+		}
+	}
+	if client := values["client:port"]; client != "-" {
+		if i := strings.LastIndexByte(client, ':'); i > 0 {
+			client = client[:i]
+		}
+		values["client"] = client
+	}
+	delete(values, "client:port")
+
+	r := new(AccessRecord)
+	if err := fillFromVariables(r, values, loadBalancerFields); err != nil {
+		return nil, err
+	}
+	// A time of -1 means the request never got that far, and so that the
+	// duration of the whole request is not known.
+	r.HasDuration = true
+	for _, name := range []string{"request_processing_time", targetTime, "response_processing_time"} {
+		secs, err := strconv.ParseFloat(values[name], 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w for %s in load balancer log line: %s", ErrInvalidValue, name, line)
+		}
+		if secs < 0 {
+			r.HasDuration = false
+		} else {
+			r.Duration += time.Duration(secs * float64(time.Second))
+		}
+	}
+	return r, nil
+}
+
+// cloudFrontFieldNames are the fields of a CloudFront standard log entry in
+// order, as listed by its "#Fields:" header.
+var cloudFrontFieldNames = []string{
+	"date", "time", "x-edge-location", "sc-bytes", "c-ip", "cs-method", "cs(Host)",
+	"cs-uri-stem", "sc-status", "cs(Referer)", "cs(User-Agent)", "cs-uri-query",
+	"cs(Cookie)", "x-edge-result-type", "x-edge-request-id", "x-host-header",
+	"cs-protocol", "cs-bytes", "time-taken", "x-forwarded-for", "ssl-protocol",
+	"ssl-cipher", "x-edge-response-result-type", "cs-protocol-version", "fle-status",
+	"fle-encrypted-fields", "c-port", "time-to-first-byte",
+	"x-edge-detailed-result-type", "sc-content-type", "sc-content-len",
+	"sc-range-start", "sc-range-end",
+}
+
+// CloudFrontParser parses CloudFront standard access logs, which are W3C
+// extended logs separated by tabs. The host is the Host header the viewer sent,
+// or the distribution's domain when there was none. Fields without a
+// counterpart in AccessRecord are kept in Extra under their W3C name.
+type CloudFrontParser struct{}
+
+// Name implements Parser.
+func (CloudFrontParser) Name() string {
+	return "cloudfront"
+}
+
+// Parse implements Parser.
+func (CloudFrontParser) Parse(line string) (*AccessRecord, error) {
+	if strings.HasPrefix(line, "#") {
+		return nil, ErrHeaderLine
+	}
+	fields := strings.Split(line, "\t")
+	if len(fields) < 19 {
+		return nil, fmt.Errorf("%w: too few in CloudFront log line: %s", ErrFieldCount, line)
+	}
+	return w3cRecord(fields, cloudFrontFieldNames, "", time.Second, false)
+}
@@ -0,0 +1,108 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+const albLine = `https 2018-07-02T22:23:00.186641Z app/my-loadbalancer/50dc6c495c0c9188 192.168.131.39:2817 10.0.0.1:80 0.086 0.048 0.037 200 201 0 57 "GET https://www.example.com:443/pages/create?x=1 HTTP/1.1" "curl/7.46.0" ECDHE-RSA-AES128-GCM-SHA256 TLSv1.2 arn:aws:elasticloadbalancing:us-east-2:123456789012:targetgroup/my-targets/73e2d6bc24d8a067 "Root=1-58337281-1d84f3d73c47ec4e58577259" "www.example.com" "arn:aws:acm:us-east-2:123456789012:certificate/12345678-1234-1234-1234-123456789012" 1 2018-07-02T22:22:48.364000Z "authenticate,forward" "-" "-" "10.0.0.1:80" "200" "-" "-" TID_1234abcd5678ef90`
+
+const elbLine = `2015-05-13T23:39:43.945958Z my-loadbalancer 192.168.131.39:2817 10.0.0.1:80 0.000073 -1 0.000057 504 0 0 0 "GET http://www.example.com:80/pages HTTP/1.1" "curl/7.38.0" - -`
+
+const cloudFrontLine = "2019-12-04\t21:02:31\tLAX1\t392\t192.0.2.100\tGET\td111111abcdef8.cloudfront.net\t/pages/index.html\t200\t-\tMozilla/5.0%20(Windows%20NT%2010.0)\tid=7\t-\tHit\tSOX4xwn4XV6Q4rgb7XiVGOHms_BGlTAC4KyHmureZmBNrjGdRLiNIQ==\twww.example.com\thttps\t23\t0.002\t-\tTLSv1.2\tECDHE-RSA-AES128-GCM-SHA256\tHit\tHTTP/2.0\t-\t-\t11040\t0.001\tHit\ttext/html\t78\t-\t-"
+
+func TestALBParser(t *testing.T) {
+	r, err := ALBParser{}.Parse(albLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Time.Unix() != 1530570180 || r.Client != "192.168.131.39" || r.Host != "www.example.com" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.URL.Path != "/pages/create" || r.Method != "GET" || r.UserAgent != "curl/7.46.0" {
+		t.Errorf("Unexpected request %s %s from %s", r.Method, r.URL, r.UserAgent)
+	}
+	if r.Status != 200 || r.Bytes != 57 || r.Duration != 171*time.Millisecond {
+		t.Errorf("Unexpected status %d, bytes %d or duration %s", r.Status, r.Bytes, r.Duration)
+	}
+	if r.Extra["target_status_code"] != "201" || r.Extra["target_processing_time"] != "0.048" || r.Extra["conn_trace_id"] != "TID_1234abcd5678ef90" {
+		t.Errorf("Unexpected extras %v", r.Extra)
+	}
+}
+
+func TestELBParser(t *testing.T) {
+	r, err := ELBParser{}.Parse(elbLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Host != "www.example.com" || r.URL.Path != "/pages" || r.Status != 504 {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.Duration != 130*time.Microsecond {
+		t.Errorf("Expected the backend time of -1 to be left out but got %s", r.Duration)
+	}
+	if r.Extra["backend_status_code"] != "0" || r.Extra["backend:port"] != "10.0.0.1:80" {
+		t.Errorf("Unexpected extras %v", r.Extra)
+	}
+}
+
+func TestCloudFrontParser(t *testing.T) {
+	r, err := CloudFrontParser{}.Parse(cloudFrontLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if !r.Time.Equal(time.Date(2019, 12, 4, 21, 2, 31, 0, time.UTC)) {
+		t.Errorf("Unexpected time %s", r.Time)
+	}
+	if r.Host != "www.example.com" || r.URL.Path != "/pages/index.html" || r.URL.RawQuery != "id=7" {
+		t.Errorf("Unexpected host %s or URL %s", r.Host, r.URL)
+	}
+	if r.Status != 200 || r.Bytes != 392 || r.Duration != 2*time.Millisecond {
+		t.Errorf("Unexpected status %d, bytes %d or duration %s", r.Status, r.Bytes, r.Duration)
+	}
+	if r.UserAgent != "Mozilla/5.0 (Windows NT 10.0)" || r.Extra["x-edge-result-type"] != "Hit" {
+		t.Errorf("Unexpected user agent %q or extras %v", r.UserAgent, r.Extra)
+	}
+
+	if _, err := (CloudFrontParser{}).Parse("#Version: 1.0"); err != ErrHeaderLine {
+		t.Errorf("Expected ErrHeaderLine for a header but got %v", err)
+	}
+}
+
+func TestAWSParserErrors(t *testing.T) {
+	for _, p := range []Parser{ALBParser{}, ELBParser{}, CloudFrontParser{}} {
+		for _, line := range []string{"", combinedLine, "too\tfew\tfields"} {
+			if _, err := p.Parse(line); err == nil {
+				t.Errorf("Expected %s to reject %q", p.Name(), line)
+			}
+		}
+	}
+	if _, err := (ELBParser{}).Parse(albLine); err == nil {
+		t.Errorf("Expected the ELB parser to reject an ALB line!")
+	}
+}
+
+func TestDetectAWSParsers(t *testing.T) {
+	for name, line := range map[string]string{"alb": albLine, "elb": elbLine, "cloudfront": cloudFrontLine} {
+		p, err := DetectParser([]string{line})
+		if err != nil || p.Name() != name {
+			t.Errorf("Expected to detect %s but got %v (%v)", name, p, err)
+		}
+	}
+}
+
+func TestLogStatsSkipsHeaderLines(t *testing.T) {
+	stats := NewLogStatsDefault("www.example.com")
+	stats.SetParser(CloudFrontParser{})
+	for _, line := range []string{"#Version: 1.0", "#Fields: date time", cloudFrontLine} {
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if stats.TotalSiteRequests() != 1 {
+		t.Errorf("Expected 1 request but got %d", stats.TotalSiteRequests())
+	}
+}
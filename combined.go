@@ -0,0 +1,206 @@
+package monitor
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// clfTimeLayout is the layout of the bracketed time in Common and Combined
+// Log Format lines.
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// LogFormat names one of the built in formats that LogStats can parse.
+type LogFormat int
+
+const (
+	// CommonLogFormat is the NCSA Common Log Format, parsed by CommonParser.
+	CommonLogFormat LogFormat = iota
+	// CombinedLogFormat is the Common Log Format followed by the quoted
+	// Referer and User-Agent, the default of both nginx and Apache. It is
+	// parsed by CombinedParser.
+	CombinedLogFormat
+)
+
+// CombinedEntry is a line in Combined Log Format.
+type CombinedEntry struct {
+	Client    string
+	Ident     string
+	User      string
+	Time      time.Time
+	Method    string
+	URL       *url.URL
+	Proto     string
+	Status    int
+	Bytes     int64
+	Referer   string
+	UserAgent string
+}
+
+// ParseCombined parses a line in Combined Log Format:
+//
+//	host ident user [time] "request" status bytes "referer" "user agent"
+//
+// Quoted fields may contain quotes and backslashes escaped with a backslash.
+// A "-" referer or user agent is returned as an empty string.
+func ParseCombined(line string) (*CombinedEntry, error) {
+	fields, err := splitLogFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != 9 {
+		return nil, fmt.Errorf("%w: expected 9 in a combined log line but found %d: %s", ErrFieldCount, len(fields), line)
+	}
+
+	c := new(CombinedEntry)
+	c.Client, c.Ident, c.User = fields[0], fields[1], fields[2]
+	if c.Time, err = time.Parse(clfTimeLayout, fields[3]); err != nil {
+		return nil, fmt.Errorf("%w %q in log line: %s", ErrInvalidValue, fields[3], err)
+	}
+	if c.Method, c.URL, c.Proto, err = parseRequestLine(fields[4]); err != nil {
+		return nil, err
+	}
+	if c.Status, err = strconv.Atoi(fields[5]); err != nil {
+		return nil, fmt.Errorf("%w %q for the status", ErrInvalidValue, fields[5])
+	}
+	if fields[6] != "-" {
+		if c.Bytes, err = strconv.ParseInt(fields[6], 10, 64); err != nil {
+			return nil, fmt.Errorf("%w %q for the byte count", ErrInvalidValue, fields[6])
+		}
+	}
+	c.Referer = dashToEmpty(fields[7])
+	c.UserAgent = dashToEmpty(fields[8])
+	return c, nil
+}
+
+// splitLogFields splits a line on spaces, keeping [bracketed] and "quoted"
+// fields together and removing their delimiters and escapes.
+func splitLogFields(line string) ([]string, error) {
+	var fields []string
+	for i := 0; i < len(line); {
+		switch line[i] {
+		case ' ':
+			i++
+		case '[':
+			end := strings.IndexByte(line[i:], ']')
+			if end < 0 {
+				return nil, fmt.Errorf("%w: [ in log line: %s", ErrUnterminated, line)
+			}
+			fields = append(fields, line[i+1:i+end])
+			i += end + 1
+		case '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(line) && line[j] != '"'; j++ {
+				if line[j] == '\\' && j+1 < len(line) {
+					j++
+				}
+				b.WriteByte(line[j])
+			}
+			if j >= len(line) {
+				return nil, fmt.Errorf("%w: quote in log line: %s", ErrUnterminated, line)
+			}
+			fields = append(fields, b.String())
+			i = j + 1
+		default:
+			end := strings.IndexByte(line[i:], ' ')
+			if end < 0 {
+				end = len(line) - i
+			}
+			fields = append(fields, line[i:i+end])
+			i += end
+		}
+	}
+	return fields, nil
+}
+
+// parseRequestLine splits "GET /path HTTP/1.1" into its parts.
+func parseRequestLine(request string) (string, *url.URL, string, error) {
+	parts := strings.Split(request, " ")
+	if len(parts) != 3 {
+		return "", nil, "", fmt.Errorf("%w: %s", ErrMalformedRequest, request)
+	}
+	u, err := url.ParseRequestURI(parts[1])
+	if err != nil {
+		return "", nil, "", fmt.Errorf("%w: %s", ErrMalformedRequest, err)
+	}
+	return parts[0], u, parts[2], nil
+}
+
+func dashToEmpty(s string) string {
+	if s == "-" {
+		return ""
+	}
+	return s
+}
+
+// SetLogFormat sets the format of the lines given to ProcessEntry. The default
+// is CommonLogFormat.
+func (stats *LogStats) SetLogFormat(format LogFormat) {
+	if format == CombinedLogFormat {
+		stats.SetParser(CombinedParser{})
+	} else {
+		stats.SetParser(CommonParser{})
+	}
+}
+
+// NamedCount is a value, such as a referer, and how many times it was seen.
+type NamedCount struct {
+	Name  string
+	Count int64
+}
+
+// recordClient counts the referer and user agent of a request to the section.
+func (s *SectionStats) recordClient(referer string, userAgent string) {
+	if referer != "" {
+		if s.referers == nil {
+			s.referers = make(map[string]int64)
+		}
+		countClient(s.referers, referer)
+	}
+	if userAgent != "" {
+		if s.userAgents == nil {
+			s.userAgents = make(map[string]int64)
+		}
+		countClient(s.userAgents, userAgent)
+	}
+}
+
+// countClient counts name in counts. New names are copied so that a name cut
+// from a log line does not keep the whole line in memory.
+func countClient(counts map[string]int64, name string) {
+	if _, ok := counts[name]; !ok {
+		name = strings.Clone(name)
+	}
+	counts[name]++
+}
+
+// TopReferers returns up to num of the most common referers of the section.
+func (s *SectionStats) TopReferers(num int) []NamedCount {
+	return topCounts(s.referers, num)
+}
+
+// TopUserAgents returns up to num of the most common user agents of the section.
+func (s *SectionStats) TopUserAgents(num int) []NamedCount {
+	return topCounts(s.userAgents, num)
+}
+
+func topCounts(counts map[string]int64, num int) []NamedCount {
+	var top []NamedCount
+	for name, count := range counts {
+		top = append(top, NamedCount{Name: name, Count: count})
+	}
+	sort.Slice(top, func(i, j int) bool {
+		if top[i].Count != top[j].Count {
+			return top[i].Count > top[j].Count
+		}
+		return top[i].Name < top[j].Name
+	})
+	if len(top) > num {
+		top = top[:num]
+	}
+	return top
+}
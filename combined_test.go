@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"testing"
+)
+
+func TestParseCombined(t *testing.T) {
+	line := `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/view?id=1 HTTP/1.1" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`
+	c, err := ParseCombined(line)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+
+	if c.Client != "127.0.0.1" || c.User != "frank" || c.Method != "GET" || c.Proto != "HTTP/1.1" {
+		t.Errorf("Unexpected request fields %+v", c)
+	}
+	if c.Time.Unix() != 971211336 {
+		t.Errorf("Expected time 971211336 but got %d instead.", c.Time.Unix())
+	}
+	if c.URL.Hostname() != "my.site.com" || c.URL.Path != "/pages/view" {
+		t.Errorf("Unexpected URL %s", c.URL)
+	}
+	if c.Status != 200 || c.Bytes != 2326 {
+		t.Errorf("Expected status 200 and 2326 bytes but got %d and %d", c.Status, c.Bytes)
+	}
+	if c.Referer != "http://www.example.com/start.html" {
+		t.Errorf("Unexpected referer %s", c.Referer)
+	}
+	if c.UserAgent != "Mozilla/4.08 [en] (Win98; I ;Nav)" {
+		t.Errorf("Unexpected user agent %s", c.UserAgent)
+	}
+}
+
+func TestParseCombinedEscapedQuotes(t *testing.T) {
+	line := `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /search HTTP/1.1" 304 - "-" "Agent \"quoted\" \\ slash"`
+	c, err := ParseCombined(line)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if c.UserAgent != `Agent "quoted" \ slash` {
+		t.Errorf("Expected the escaped quotes to be unescaped but got %s", c.UserAgent)
+	}
+	if c.Referer != "" || c.Bytes != 0 {
+		t.Errorf("Expected empty referer and 0 bytes but got %q and %d", c.Referer, c.Bytes)
+	}
+}
+
+func TestParseCombinedErrors(t *testing.T) {
+	lines := []string{
+		"This is not a properly formatted string",
+		`127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.1" 200 1 "-" "unterminated`,
+		`127.0.0.1 - - [not a time] "GET /a HTTP/1.1" 200 1 "-" "-"`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET" 200 1 "-" "-"`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.1" OK 1 "-" "-"`,
+	}
+	for _, line := range lines {
+		if _, err := ParseCombined(line); err == nil {
+			t.Errorf("Expected an error for %s", line)
+		}
+	}
+}
+
+func TestLogStatsCombined(t *testing.T) {
+	entries := []string{
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/a HTTP/1.1" 200 1 "http://search.example.com/" "curl/8.0"`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:37 -0700] "GET http://my.site.com/pages/b HTTP/1.1" 200 1 "http://search.example.com/" "Mozilla/5.0 \"X\""`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:38 -0700] "GET http://my.site.com/pages/c HTTP/1.1" 200 1 "-" "curl/8.0"`,
+	}
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetLogFormat(CombinedLogFormat)
+	for _, v := range entries {
+		if err := stats.ProcessEntry(&v); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+
+	sections := stats.PopularSections()
+	if len(sections) != 1 || sections[0].totalAccess != 3 {
+		t.Errorf("Expected one section with 3 accesses")
+		t.FailNow()
+	}
+	referers := sections[0].TopReferers(5)
+	if len(referers) != 1 || referers[0] != (NamedCount{"http://search.example.com/", 2}) {
+		t.Errorf("Unexpected referers %v", referers)
+	}
+	agents := sections[0].TopUserAgents(1)
+	if len(agents) != 1 || agents[0] != (NamedCount{"curl/8.0", 2}) {
+		t.Errorf("Unexpected user agents %v", agents)
+	}
+	stats.PrintPopulartSections(1)
+}
@@ -0,0 +1,237 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ContainerMetadata describes the container that wrote a log file, as far as
+// it can be told from the file's path.
+type ContainerMetadata struct {
+	Namespace   string
+	Pod         string
+	Container   string
+	ContainerID string
+}
+
+// String returns "namespace/pod/container", or the container ID for plain
+// Docker containers.
+func (m *ContainerMetadata) String() string {
+	if m.Pod == "" {
+		return m.ContainerID
+	}
+	return m.Namespace + "/" + m.Pod + "/" + m.Container
+}
+
+var (
+	// /var/log/containers/<pod>_<namespace>_<container>-<id>.log
+	containersPath = regexp.MustCompile(`^([^_]+)_([^_]+)_(.+)-([0-9a-f]{64})\.log$`)
+	// /var/log/pods/<namespace>_<pod>_<uid>/<container>/<restarts>.log
+	podsPath = regexp.MustCompile(`/pods/([^_/]+)_([^_/]+)_[^/]+/([^/]+)/\d+\.log$`)
+	// /var/lib/docker/containers/<id>/<id>-json.log
+	dockerPath = regexp.MustCompile(`/containers/([0-9a-f]{64})/[0-9a-f]{64}-json\.log$`)
+)
+
+// ContainerMetadataFromPath returns the metadata encoded in the path of a
+// Kubernetes or Docker log file, or nil if path is not one of them.
+func ContainerMetadataFromPath(path string) *ContainerMetadata {
+	path = filepath.ToSlash(path)
+	if res := containersPath.FindStringSubmatch(filepath.Base(path)); res != nil {
+		return &ContainerMetadata{Pod: res[1], Namespace: res[2], Container: res[3], ContainerID: res[4]}
+	}
+	if res := podsPath.FindStringSubmatch(path); res != nil {
+		return &ContainerMetadata{Namespace: res[1], Pod: res[2], Container: res[3]}
+	}
+	if res := dockerPath.FindStringSubmatch(path); res != nil {
+		return &ContainerMetadata{ContainerID: res[1]}
+	}
+	return nil
+}
+
+// LineDecoder unwraps log text from the envelope a container runtime writes
+// around it.
+type LineDecoder interface {
+	// Decode returns the text inside line. It returns false when line is only
+	// the start of a longer line, whose text is returned once the rest has
+	// been decoded.
+	Decode(line string) (string, bool, error)
+}
+
+// partialLines is a LineDecoder that joins the parts of a long line in a
+// lineBuffer, so that a LogReader can hold it to the reader's own maximum line
+// length.
+type partialLines interface {
+	partialBuffer() *lineBuffer
+}
+
+// DockerJSONDecoder decodes Docker's json-file format. Docker splits long
+// lines over several records, all but the last of which lack the newline.
+// Reassembled lines are not limited in length unless the decoder is used by a
+// LogReader, which applies its own maximum line length.
+type DockerJSONDecoder struct {
+	partial lineBuffer
+}
+
+type dockerJSONRecord struct {
+	Log    string `json:"log"`
+	Stream string `json:"stream"`
+	Time   string `json:"time"`
+}
+
+// Decode implements LineDecoder.
+func (d *DockerJSONDecoder) Decode(line string) (string, bool, error) {
+	var rec dockerJSONRecord
+	if err := json.Unmarshal([]byte(line), &rec); err != nil {
+		return "", false, err
+	}
+	d.partial.add([]byte(rec.Log))
+	if !strings.HasSuffix(rec.Log, "\n") {
+		return "", false, nil
+	}
+	text, ok := d.partial.line()
+	return text, ok, nil
+}
+
+func (d *DockerJSONDecoder) partialBuffer() *lineBuffer {
+	return &d.partial
+}
+
+// CRIDecoder decodes the CRI log format used by containerd and CRI-O:
+// "<time> <stream> <P|F> <text>", where P marks a partial line that continues
+// in the next record and F the final part of a line. Like DockerJSONDecoder,
+// it only limits the length of reassembled lines when used by a LogReader.
+type CRIDecoder struct {
+	partial lineBuffer
+}
+
+// Decode implements LineDecoder.
+func (d *CRIDecoder) Decode(line string) (string, bool, error) {
+	fields := strings.SplitN(line, " ", 4)
+	if len(fields) < 3 || (fields[1] != "stdout" && fields[1] != "stderr") {
+		return "", false, errors.New("Not a CRI log line: " + line)
+	}
+	text := ""
+	if len(fields) == 4 {
+		text = fields[3]
+	}
+	switch strings.SplitN(fields[2], ":", 2)[0] {
+	case "P":
+		d.partial.add([]byte(text))
+		return "", false, nil
+	case "F":
+	default:
+		return "", false, errors.New("Unknown CRI log tag in: " + line)
+	}
+	d.partial.add([]byte(text))
+	text, ok := d.partial.line()
+	return text, ok, nil
+}
+
+func (d *CRIDecoder) partialBuffer() *lineBuffer {
+	return &d.partial
+}
+
+// NewContainerLogReader constructs a log reader for a container log file that
+// unwraps every line, using the Docker decoder for "-json.log" files and the
+// CRI decoder otherwise.
+func NewContainerLogReader(fName string) *LogReader {
+	r := NewLogReader(fName)
+	if strings.HasSuffix(fName, "-json.log") {
+		r.SetDecoder(new(DockerJSONDecoder))
+	} else {
+		r.SetDecoder(new(CRIDecoder))
+	}
+	return r
+}
+
+// SetDecoder makes the reader pass every line through d. Lines d fails to decode
+// are logged and skipped. Lines the decoder reassembles from several records
+// are held to the reader's maximum line length, and counted by OversizedLines
+// when they go over it.
+func (l *LogReader) SetDecoder(d LineDecoder) {
+	l.decoder = d
+	l.decoded = -1
+	l.limitDecoder()
+}
+
+// decoderIdle reports whether the decoder is not part way through a line, as
+// when it has just skipped one that was too long.
+func (l *LogReader) decoderIdle() bool {
+	p, ok := l.decoder.(partialLines)
+	return ok && p.partialBuffer().size == 0
+}
+
+func (l *LogReader) limitDecoder() {
+	if p, ok := l.decoder.(partialLines); ok {
+		b := p.partialBuffer()
+		b.maxLength = l.pending.maxLength
+		b.truncate = l.pending.truncate
+	}
+}
+
+// Metadata returns the container metadata from the path of the file being
+// read, or nil if it is not a container log file.
+func (l *LogReader) Metadata() *ContainerMetadata {
+	return ContainerMetadataFromPath(l.fileName)
+}
+
+// decode decodes entries in place. A line reassembled from several records
+// keeps the offset of the first of them.
+func (l *LogReader) decode(entries []LogEntry) []LogEntry {
+	if l.decoder == nil {
+		return entries
+	}
+	decoded := entries[:0]
+	for _, e := range entries {
+		text, ok, err := l.decoder.Decode(e.Text)
+		if err != nil {
+			log.Println("Skipping undecodable line in ", l.fileName, ": ", err)
+			continue
+		}
+		if l.decoded < 0 {
+			l.decoded = e.Offset
+		}
+		if ok {
+			e.Text = text
+			e.Offset = l.decoded
+			decoded = append(decoded, e)
+		}
+		if ok || l.decoderIdle() {
+			l.decoded = -1
+		}
+	}
+	if len(decoded) == 0 {
+		return nil
+	}
+	return decoded
+}
+
+// ProcessContainerEntry processes a log entry like ProcessEntry and, when it
+// counts towards the site, also counts it against the container it came from.
+func (stats *LogStats) ProcessContainerEntry(e *string, meta *ContainerMetadata) error {
+	before := stats.totalSiteRequests
+	source := ""
+	if meta != nil {
+		source = meta.String()
+	}
+	if err := stats.ProcessEntryAt(source, -1, e); err != nil {
+		return err
+	}
+	if meta != nil && stats.totalSiteRequests > before {
+		if stats.containerRequests == nil {
+			stats.containerRequests = make(map[string]int)
+		}
+		stats.containerRequests[meta.String()]++
+	}
+	return nil
+}
+
+// ContainerRequests returns how many requests to the site each container has
+// logged, keyed by ContainerMetadata.String.
+func (stats *LogStats) ContainerRequests() map[string]int {
+	return stats.containerRequests
+}
@@ -0,0 +1,136 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestContainerMetadataFromPath(t *testing.T) {
+	id := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	tests := map[string]ContainerMetadata{
+		"/var/log/containers/ingress-7d9f_kube-system_controller-" + id + ".log": {Namespace: "kube-system", Pod: "ingress-7d9f", Container: "controller", ContainerID: id},
+		"/var/log/pods/kube-system_ingress-7d9f_5a1b-22/controller/3.log":        {Namespace: "kube-system", Pod: "ingress-7d9f", Container: "controller"},
+		"/var/lib/docker/containers/" + id + "/" + id + "-json.log":              {ContainerID: id},
+	}
+	for path, expected := range tests {
+		actual := ContainerMetadataFromPath(path)
+		if actual == nil || *actual != expected {
+			t.Errorf("Expected %+v from %s but got %+v instead.", expected, path, actual)
+		}
+	}
+	if ContainerMetadataFromPath("/var/log/nginx/access.log") != nil {
+		t.Errorf("A plain log file should not have container metadata!")
+	}
+}
+
+func TestDockerJSONDecoder(t *testing.T) {
+	d := new(DockerJSONDecoder)
+	text, ok, err := d.Decode(`{"log":"one \"quoted\"\n","stream":"stdout","time":"2026-10-16T08:00:00.000000001Z"}`)
+	if err != nil || !ok || text != `one "quoted"` {
+		t.Errorf("Expected a complete line but got %q %v %v", text, ok, err)
+	}
+
+	_, ok, _ = d.Decode(`{"log":"first half ","stream":"stdout","time":"2026-10-16T08:00:00Z"}`)
+	if ok {
+		t.Errorf("A record without a newline is only part of a line!")
+	}
+	text, ok, _ = d.Decode(`{"log":"second half\n","stream":"stdout","time":"2026-10-16T08:00:00Z"}`)
+	if !ok || text != "first half second half" {
+		t.Errorf("Expected the line to be reassembled but got %q", text)
+	}
+
+	if _, _, err := d.Decode("not json"); err == nil {
+		t.Errorf("Expected an error for a line that is not JSON!")
+	}
+}
+
+func TestCRIDecoder(t *testing.T) {
+	d := new(CRIDecoder)
+	text, ok, err := d.Decode("2026-10-16T08:00:00.000000001Z stdout F one two")
+	if err != nil || !ok || text != "one two" {
+		t.Errorf("Expected a complete line but got %q %v %v", text, ok, err)
+	}
+
+	_, ok, _ = d.Decode("2026-10-16T08:00:00Z stdout P first ")
+	if ok {
+		t.Errorf("A P tagged line is only part of a line!")
+	}
+	d.Decode("2026-10-16T08:00:00Z stdout P half ")
+	text, ok, _ = d.Decode("2026-10-16T08:00:00Z stdout F second half")
+	if !ok || text != "first half second half" {
+		t.Errorf("Expected the line to be reassembled but got %q", text)
+	}
+
+	text, ok, _ = d.Decode("2026-10-16T08:00:00Z stderr F")
+	if !ok || text != "" {
+		t.Errorf("Expected an empty line but got %q", text)
+	}
+
+	for _, line := range []string{"garbage", "2026-10-16T08:00:00Z stdin F x", "2026-10-16T08:00:00Z stdout X x"} {
+		if _, _, err := d.Decode(line); err == nil {
+			t.Errorf("Expected an error for %q!", line)
+		}
+	}
+}
+
+func TestContainerLogReader(t *testing.T) {
+	id := "0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+	dir := filepath.Join(t.TempDir(), "containers")
+	os.Mkdir(dir, 0755)
+	fName := filepath.Join(dir, "ingress-7d9f_kube-system_controller-"+id+".log")
+	writeLines(t, fName,
+		`2026-10-16T08:00:00Z stdout P 127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "POST http://my.site.com/`,
+		`2026-10-16T08:00:00Z stdout F pages/create HTTP/1.0" 200 2326`,
+		`not a CRI line`,
+		`2026-10-16T08:00:01Z stdout F 127.0.0.1 user-identifier frank [10/Oct/2000:13:55:37 -0700] "POST http://other.site.com/pets/create HTTP/1.0" 200 2326`)
+
+	r := NewContainerLogReader(fName)
+	defer r.Close()
+	entries, err := r.GetNewLogEntries()
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected 2 decoded entries but got %v (%v)", entries, err)
+		t.FailNow()
+	}
+
+	stats := NewLogStatsDefault("my.site.com")
+	for _, e := range entries {
+		if err := stats.ProcessContainerEntry(&e, r.Metadata()); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	counts := stats.ContainerRequests()
+	if len(counts) != 1 || counts["kube-system/ingress-7d9f/controller"] != 1 {
+		t.Errorf("Expected one request from the controller container but got %v", counts)
+	}
+}
+
+func TestContainerLogReaderLongLines(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "0.log")
+	writeLines(t, fName,
+		`2026-10-16T08:00:00Z stdout P 01234567890123456789`,
+		`2026-10-16T08:00:00Z stdout P 01234567890123456789`,
+		`2026-10-16T08:00:00Z stdout F 01234567890123456789`,
+		`2026-10-16T08:00:01Z stdout F short`)
+
+	r := NewContainerLogReader(fName)
+	defer r.Close()
+	// Each record fits, but the line they make up does not.
+	r.SetMaxLineLength(50, false)
+	entries, err := r.GetNewEntries()
+	if err != nil || len(entries) != 1 || entries[0].Text != "short" || entries[0].Offset != 3*51 {
+		t.Errorf("Expected only the short line but got %v (%v)", entries, err)
+	}
+	if r.OversizedLines() != 1 {
+		t.Errorf("Expected 1 oversized line but got %d", r.OversizedLines())
+	}
+
+	d := new(DockerJSONDecoder)
+	d.partialBuffer().maxLength = 5
+	d.partialBuffer().truncate = true
+	d.Decode(`{"log":"0123","stream":"stdout"}`)
+	text, ok, err := d.Decode(`{"log":"456789\n","stream":"stdout"}`)
+	if err != nil || !ok || text != "01234" {
+		t.Errorf("Expected the line to be truncated but got %q %v %v", text, ok, err)
+	}
+}
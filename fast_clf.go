@@ -0,0 +1,277 @@
+package monitor
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	errFastFields  = fmt.Errorf("%w: malformed fields in common log line", ErrFormatMismatch)
+	errFastTime    = fmt.Errorf("%w: time in common log line", ErrInvalidValue)
+	errFastRequest = fmt.Errorf("%w in common log line", ErrMalformedRequest)
+	errFastStatus  = fmt.Errorf("%w: status in common log line", ErrInvalidValue)
+	errFastBytes   = fmt.Errorf("%w: byte count in common log line", ErrInvalidValue)
+)
+
+// FastEntry is a line of a Common or Combined Log Format log as parsed by
+// FastParser. Its strings are cut from the parsed line rather than copied.
+type FastEntry struct {
+	Client    string
+	Ident     string
+	User      string
+	Time      time.Time
+	Method    string
+	Target    string // The request target as logged
+	Host      string // The target's host without its port, when it has one
+	Path      string // The target without its scheme and host
+	Proto     string
+	Status    int
+	Bytes     int64
+	Referer   string
+	UserAgent string
+}
+
+// FastParser parses Common and Combined Log Format lines without regular
+// expressions, url.URL or allocations in the common case, for logs too busy
+// for CombinedParser. A LogStats whose parser is a FastParser processes its
+// entries on this path. A FastParser reuses its entry and buffers between
+// calls, so it must not be used by more than one goroutine at a time.
+type FastParser struct {
+	entry    FastEntry
+	buf      []byte // For removing escapes from quoted fields
+	zone     *time.Location
+	zoneSecs int
+}
+
+// NewFastParser constructs a FastParser.
+func NewFastParser() *FastParser {
+	p := new(FastParser)
+	p.zone = time.UTC
+	return p
+}
+
+// Name implements Parser.
+func (p *FastParser) Name() string {
+	return "fast-combined"
+}
+
+// Parse implements Parser, building an AccessRecord like CombinedParser does.
+// Use ParseFast to avoid the allocations this needs.
+func (p *FastParser) Parse(line string) (*AccessRecord, error) {
+	e, err := p.ParseFast(line)
+	if err != nil {
+		return nil, err
+	}
+	u, err := url.ParseRequestURI(e.Target)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessRecord{
+		Time:      e.Time,
+		Client:    e.Client,
+		Method:    e.Method,
+		URL:       u,
+		Host:      e.Host,
+		Status:    e.Status,
+		Bytes:     e.Bytes,
+		Referer:   e.Referer,
+		UserAgent: e.UserAgent,
+		Extra:     map[string]string{"ident": e.Ident, "user": e.User, "protocol": e.Proto},
+	}, nil
+}
+
+// ParseFast parses a line into the parser's entry, which is overwritten by the
+// next call.
+func (p *FastParser) ParseFast(line string) (*FastEntry, error) {
+	e := &p.entry
+	*e = FastEntry{}
+	var ok bool
+	var rest, when, request, status, size string
+
+	if e.Client, rest, ok = nextField(line); !ok {
+		return nil, errFastFields
+	}
+	if e.Ident, rest, ok = nextField(rest); !ok {
+		return nil, errFastFields
+	}
+	if e.User, rest, ok = nextField(rest); !ok {
+		return nil, errFastFields
+	}
+	if !strings.HasPrefix(rest, "[") {
+		return nil, errFastFields
+	}
+	end := strings.IndexByte(rest, ']')
+	if end < 0 || end+1 < len(rest) && rest[end+1] != ' ' {
+		return nil, errFastFields
+	}
+	when, rest = rest[1:end], strings.TrimLeft(rest[end+1:], " ")
+	if request, rest, ok = p.quotedField(rest, false); !ok {
+		return nil, errFastFields
+	}
+	if status, rest, ok = nextField(rest); !ok {
+		return nil, errFastFields
+	}
+	size, rest, _ = nextField(rest)
+	if rest != "" {
+		if e.Referer, rest, ok = p.quotedField(rest, true); !ok {
+			return nil, errFastFields
+		}
+		if e.UserAgent, rest, ok = p.quotedField(rest, true); !ok || rest != "" {
+			return nil, errFastFields
+		}
+	}
+	if e.Ident == "-" {
+		e.Ident = ""
+	}
+	if e.User == "-" {
+		e.User = ""
+	}
+
+	var err error
+	if e.Time, err = p.parseTime(when); err != nil {
+		return nil, err
+	}
+	if e.Method, request, ok = strings.Cut(request, " "); !ok {
+		return nil, errFastRequest
+	}
+	if e.Target, e.Proto, ok = strings.Cut(request, " "); !ok || e.Target == "" || strings.IndexByte(e.Proto, ' ') >= 0 {
+		return nil, errFastRequest
+	}
+	e.Host, e.Path = splitTarget(e.Target)
+	if n, ok := parseDigits(status); ok && len(status) == 3 {
+		e.Status = int(n)
+	} else {
+		return nil, errFastStatus
+	}
+	if size != "-" {
+		if e.Bytes, ok = parseDigits(size); !ok {
+			return nil, errFastBytes
+		}
+	}
+	return e, nil
+}
+
+// nextField cuts the field up to the next space from line.
+func nextField(line string) (string, string, bool) {
+	field, rest, _ := strings.Cut(line, " ")
+	return field, strings.TrimLeft(rest, " "), field != ""
+}
+
+// quotedField cuts a "quoted" field from line, removing backslash escapes.
+// When dash is set, a field of "-" is returned as empty.
+func (p *FastParser) quotedField(line string, dash bool) (string, string, bool) {
+	if !strings.HasPrefix(line, `"`) {
+		return "", "", false
+	}
+	escaped := false
+	i := 1
+	for ; i < len(line) && line[i] != '"'; i++ {
+		if line[i] == '\\' {
+			escaped = true
+			i++
+		}
+	}
+	if i >= len(line) {
+		return "", "", false
+	}
+	field, rest := line[1:i], strings.TrimLeft(line[i+1:], " ")
+	if escaped {
+		p.buf = p.buf[:0]
+		for j := 0; j < len(field); j++ {
+			if field[j] == '\\' && j+1 < len(field) {
+				j++
+			}
+			p.buf = append(p.buf, field[j])
+		}
+		field = string(p.buf)
+	}
+	if dash && field == "-" {
+		field = ""
+	}
+	return field, rest, true
+}
+
+var monthAbbreviations = [...]string{"Jan", "Feb", "Mar", "Apr", "May", "Jun", "Jul", "Aug", "Sep", "Oct", "Nov", "Dec"}
+
+// parseTime parses a time in clfTimeLayout. The location of the last time zone
+// seen is kept so that it is not made again for every line.
+func (p *FastParser) parseTime(v string) (time.Time, error) {
+	// 02/Jan/2006:15:04:05 -0700
+	if len(v) != 26 || v[2] != '/' || v[6] != '/' || v[11] != ':' || v[14] != ':' || v[17] != ':' || v[20] != ' ' {
+		return time.Time{}, errFastTime
+	}
+	month := 0
+	for i, m := range monthAbbreviations {
+		if v[3:6] == m {
+			month = i + 1
+			break
+		}
+	}
+	day, ok1 := parseDigits(v[0:2])
+	year, ok2 := parseDigits(v[7:11])
+	hour, ok3 := parseDigits(v[12:14])
+	min, ok4 := parseDigits(v[15:17])
+	sec, ok5 := parseDigits(v[18:20])
+	zh, ok6 := parseDigits(v[22:24])
+	zm, ok7 := parseDigits(v[24:26])
+	if month == 0 || !(ok1 && ok2 && ok3 && ok4 && ok5 && ok6 && ok7) || (v[21] != '+' && v[21] != '-') {
+		return time.Time{}, errFastTime
+	}
+	if day < 1 || day > 31 || hour > 23 || min > 59 || sec > 60 {
+		return time.Time{}, errFastTime
+	}
+
+	offset := int(zh*3600 + zm*60)
+	if v[21] == '-' {
+		offset = -offset
+	}
+	if offset != p.zoneSecs || p.zone == nil {
+		p.zone = time.FixedZone("", offset)
+		p.zoneSecs = offset
+	}
+	return time.Date(int(year), time.Month(month), int(day), int(hour), int(min), int(sec), 0, p.zone), nil
+}
+
+// parseDigits parses a non-negative decimal number.
+func parseDigits(v string) (int64, bool) {
+	if v == "" || len(v) > 18 {
+		return 0, false
+	}
+	var n int64
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c < '0' || c > '9' {
+			return 0, false
+		}
+		n = n*10 + int64(c-'0')
+	}
+	return n, true
+}
+
+// processFast processes a line with a FastParser, skipping the AccessRecord.
+func (stats *LogStats) processFast(p *FastParser, line string) error {
+	e, err := p.ParseFast(line)
+	if err != nil {
+		return err
+	}
+	if e.Time.IsZero() {
+		return ErrMissingTime
+	}
+	host := e.Host
+	if host == "" {
+		host = stats.defaultHost
+	}
+	if host != stats.siteName {
+		return nil
+	}
+	stats.processFastEntry(e)
+	return nil
+}
+
+// processFastEntry counts an entry parsed by a FastParser towards the site.
+func (stats *LogStats) processFastEntry(e *FastEntry) {
+	elem := stats.lookupSection(stats.siteName, e.Path)
+	stats.countAccess(elem, e.Time, e.Referer, e.UserAgent, 0, false)
+}
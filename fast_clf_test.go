@@ -0,0 +1,223 @@
+package monitor
+
+import (
+	"io"
+	"log"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestFastParser(t *testing.T) {
+	p := NewFastParser()
+	lines := []string{
+		combinedLine,
+		commonLine,
+		`127.0.0.1 - frank [10/Oct/2000:13:55:36 +0200] "GET https://user@[::1]:8443/pages/a?x=1 HTTP/1.1" 404 - "-" "Agent \"quoted\""`,
+	}
+	for _, line := range lines {
+		fast, err := p.Parse(line)
+		if err != nil {
+			t.Errorf("Failed to parse %q! %s", line, err)
+			continue
+		}
+		slow, err := CombinedParser{}.Parse(line)
+		if err != nil {
+			slow, err = CommonParser{}.Parse(line)
+		}
+		if err != nil {
+			t.Errorf("The existing parsers reject %q! %s", line, err)
+			continue
+		}
+		if !fast.Time.Equal(slow.Time) || fast.Host != slow.URL.Hostname() || fast.URL.String() != slow.URL.String() {
+			t.Errorf("Expected %+v but got %+v", slow, fast)
+		}
+		if fast.Method != slow.Method || fast.Status != slow.Status || fast.Bytes != slow.Bytes {
+			t.Errorf("Expected %+v but got %+v", slow, fast)
+		}
+		if fast.Referer != slow.Referer || fast.UserAgent != slow.UserAgent {
+			t.Errorf("Expected referer %q and user agent %q but got %q and %q", slow.Referer, slow.UserAgent, fast.Referer, fast.UserAgent)
+		}
+	}
+
+	e, _ := p.ParseFast(lines[2])
+	if e.Host != "::1" || e.User != "frank" || e.Ident != "" || e.Time.Hour() != 13 {
+		t.Errorf("Unexpected entry %+v", e)
+	}
+}
+
+func TestFastParserErrors(t *testing.T) {
+	p := NewFastParser()
+	for _, line := range []string{
+		"",
+		"garbage",
+		`127.0.0.1 - - 10/Oct/2000:13:55:36 -0700 "GET /a HTTP/1.0" 200 1`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0 200 1`,
+		`127.0.0.1 - - [10/Foo/2000:13:55:36 -0700] "GET /a HTTP/1.0" 200 1`,
+		`127.0.0.1 - - [10/Oct/2000 13:55:36 -0700] "GET /a HTTP/1.0" 200 1`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a" 200 1`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0" OK 1`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0" 200 lots`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0" 200 1 "-"`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /a HTTP/1.0" 200 1 "-" "ua" extra`,
+	} {
+		if _, err := p.ParseFast(line); err == nil {
+			t.Errorf("Expected an error for %q", line)
+		}
+	}
+}
+
+func TestTargetSection(t *testing.T) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	for target, expected := range map[string]string{
+		"http://my.site.com/pages/create": "my.site.com/pages",
+		"http://my.site.com/":             "my.site.com",
+		"https://my.site.com/a/b/c":       "my.site.com/a/b",
+		"http://My.Site.com:8080/a/b/c":   "my.site.com/a/b",
+		"/pages/create":                   "my.site.com/pages",
+	} {
+		if target[0] != '/' && GetSectionFromURL(target) != expected {
+			t.Errorf("Expected section %s for %s but got %s", expected, target, GetSectionFromURL(target))
+		}
+		line := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET ` + target + ` HTTP/1.0" 200 10 "-" "curl"`
+		for _, p := range []Parser{NewFastParser(), CombinedParser{}} {
+			stats := NewLogStatsDefault("my.site.com")
+			stats.SetParser(p)
+			stats.SetDefaultHost("my.site.com")
+			if err := stats.ProcessEntry(&line); err != nil {
+				t.Errorf("Failed to process log entry! %s", err)
+			}
+			if _, err := stats.AccessesPerMinute(expected); err != nil {
+				t.Errorf("Expected %s to count towards %s with %s! %s", target, expected, p.Name(), err)
+			}
+		}
+	}
+}
+
+func TestFastParserOriginForm(t *testing.T) {
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(NewFastParser())
+	line := `127.0.0.1 - - [10/Oct/2000:13:55:00 -0700] "GET /pages/create?x=1 HTTP/1.0" 200 10`
+	stats.ProcessEntry(&line)
+	if stats.TotalSiteRequests() != 0 {
+		t.Errorf("Expected a request without a host to be dropped without a default host!")
+	}
+	stats.SetDefaultHost("my.site.com")
+	stats.ProcessEntry(&line)
+	if _, err := stats.AccessesPerMinute("my.site.com/pages"); err != nil || stats.TotalSiteRequests() != 1 {
+		t.Errorf("Expected the request to count towards my.site.com/pages! %v", err)
+	}
+}
+
+func TestLogStatsFastParser(t *testing.T) {
+	entries := []string{
+		`127.0.0.1 - - [10/Oct/2000:13:55:00 -0700] "GET http://my.site.com/pages/create HTTP/1.0" 200 10 "http://ref.com/" "curl"`,
+		`127.0.0.1 - - [10/Oct/2000:13:55:30 -0700] "GET http://my.site.com/pages/create HTTP/1.0" 200 10 "http://ref.com/" "curl"`,
+		`127.0.0.1 - - [10/Oct/2000:13:56:00 -0700] "GET http://other.site.com/pages/create HTTP/1.0" 200 10`,
+	}
+	fast := NewLogStatsDefault("my.site.com")
+	fast.SetParser(NewFastParser())
+	slow := NewLogStatsDefault("my.site.com")
+	slow.SetLogFormat(CombinedLogFormat)
+	for i := range entries {
+		if err := fast.ProcessEntry(&entries[i]); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+		slow.ProcessEntry(&entries[i])
+	}
+	if fast.TotalSiteRequests() != 2 || fast.TotalSiteRequests() != slow.TotalSiteRequests() {
+		t.Errorf("Expected 2 requests but got %d", fast.TotalSiteRequests())
+	}
+	f, s := fast.PopularSections()[0], slow.PopularSections()[0]
+	if f.sectionName != s.sectionName || *f.accessesPerMinute != *s.accessesPerMinute {
+		t.Errorf("Expected %+v but got %+v", s, f)
+	}
+	if top := f.TopReferers(1); len(top) != 1 || top[0].Count != 2 {
+		t.Errorf("Unexpected referers %v", top)
+	}
+}
+
+func TestFastParserAllocations(t *testing.T) {
+	p := NewFastParser()
+	allocs := testing.AllocsPerRun(100, func() {
+		if _, err := p.ParseFast(combinedLine); err != nil {
+			t.Errorf("Failed to parse the line! %s", err)
+		}
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations but got %f", allocs)
+	}
+
+	stats := NewLogStatsDefault("my.site.com")
+	stats.lookupSection("my.site.com", "/pages/create")
+	allocs = testing.AllocsPerRun(100, func() {
+		stats.lookupSection("my.site.com", "/pages/view")
+	})
+	if allocs != 0 {
+		t.Errorf("Expected no allocations to find a section but got %f", allocs)
+	}
+}
+
+// benchmarkLines returns Combined Log Format lines, or Common Log Format lines
+// when combined is not set.
+func benchmarkLines(combined bool) []string {
+	var lines []string
+	start := time.Date(2026, 10, 16, 8, 0, 0, 0, time.UTC)
+	for i := 0; i < 1000; i++ {
+		ts := start.Add(time.Duration(i) * 50 * time.Millisecond).Format(clfTimeLayout)
+		section := []string{"pages", "api", "static"}[i%3]
+		line := `10.0.0.1 - - [` + ts + `] "GET http://my.site.com/` + section + `/item HTTP/1.1" 200 512`
+		if combined {
+			line += ` "http://ref.com/" "Mozilla/5.0"`
+		}
+		lines = append(lines, line)
+	}
+	return lines
+}
+
+func benchmarkProcessEntry(b *testing.B, p Parser, combined bool) {
+	log.SetOutput(io.Discard)
+	defer log.SetOutput(os.Stderr)
+	lines := benchmarkLines(combined)
+	// A threshold that is never reached keeps the alarm quiet.
+	stats := NewLogStats("my.site.com", NewOverallTimeAverage(), NewRollingTimeAverage(2), 1e9)
+	stats.SetParser(p)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		stats.ProcessEntry(&lines[i%len(lines)])
+	}
+}
+
+func BenchmarkProcessEntryCommon(b *testing.B) {
+	benchmarkProcessEntry(b, CommonParser{}, false)
+}
+
+func BenchmarkProcessEntryCombined(b *testing.B) {
+	benchmarkProcessEntry(b, CombinedParser{}, true)
+}
+
+func BenchmarkProcessEntryFast(b *testing.B) {
+	benchmarkProcessEntry(b, NewFastParser(), true)
+}
+
+func BenchmarkParseCommon(b *testing.B) {
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		CommonParser{}.Parse(commonLine)
+	}
+}
+
+func BenchmarkParseCombined(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		CombinedParser{}.Parse(combinedLine)
+	}
+}
+
+func BenchmarkParseFast(b *testing.B) {
+	p := NewFastParser()
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		p.ParseFast(combinedLine)
+	}
+}
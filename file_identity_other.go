@@ -0,0 +1,11 @@
+//go:build !unix
+
+package monitor
+
+import "os"
+
+// identityOf has no device or inode to report on this platform, so rotation
+// can only be detected through truncation.
+func identityOf(info os.FileInfo) fileIdentity {
+	return fileIdentity{}
+}
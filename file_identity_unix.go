@@ -0,0 +1,17 @@
+//go:build unix
+
+package monitor
+
+import (
+	"os"
+	"syscall"
+)
+
+// identityOf returns the device and inode of the file described by info.
+func identityOf(info os.FileInfo) fileIdentity {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return fileIdentity{}
+	}
+	return fileIdentity{Device: uint64(st.Dev), Inode: uint64(st.Ino)}
+}
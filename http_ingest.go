@@ -0,0 +1,228 @@
+package monitor
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultMaxDecompressedBytes is the most an IngestHandler reads from one
+// decompressed request body unless told otherwise.
+const DefaultMaxDecompressedBytes = 64 << 20
+
+var errDecompressedTooLarge = errors.New("The decompressed body is too large")
+
+// IngestResult is the JSON body returned for every accepted POST. When the
+// body could not be read to the end, Error says why and the counts cover the
+// lines read before that.
+type IngestResult struct {
+	Accepted int    `json:"accepted"`
+	Rejected int    `json:"rejected"`
+	Error    string `json:"error,omitempty"`
+}
+
+// IngestHandler is an http.Handler that accepts newline delimited log lines in
+// POST bodies and processes each of them with LogStats.ProcessEntry. Requests
+// must carry the shared token as "Authorization: Bearer <token>". Each client,
+// identified by its remote IP address, may send at most maxBytes of body per
+// window. Bodies may be gzip compressed with "Content-Encoding: gzip"; that
+// limit applies to the bytes sent, and the decompressed body has a limit of its
+// own. Lines are processed as they are read, and lines longer than
+// DefaultMaxLineLength are rejected.
+type IngestHandler struct {
+	stats           *LogStats
+	token           string
+	maxBytes        int64
+	maxDecompressed int64
+	window          time.Duration
+
+	mu          sync.Mutex // Guards stats and the fields below
+	windowStart time.Time
+	used        map[string]int64
+}
+
+// NewIngestHandler constructs a handler feeding stats. The LogStats must not be
+// used anywhere else while the handler is serving requests. A handler with an
+// empty token rejects every request.
+func NewIngestHandler(stats *LogStats, token string, maxBytes int64, window time.Duration) *IngestHandler {
+	h := new(IngestHandler)
+	h.stats = stats
+	h.token = token
+	h.maxBytes = maxBytes
+	h.maxDecompressed = DefaultMaxDecompressedBytes
+	h.window = window
+	h.used = make(map[string]int64)
+	return h
+}
+
+func (h *IngestHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", http.MethodPost)
+		http.Error(w, "only POST is supported", http.StatusMethodNotAllowed)
+		return
+	}
+	auth := r.Header.Get("Authorization")
+	if h.token == "" || !strings.HasPrefix(auth, "Bearer ") || subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(h.token)) != 1 {
+		http.Error(w, "invalid token", http.StatusUnauthorized)
+		return
+	}
+
+	client, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		client = r.RemoteAddr
+	}
+	reserved, ok := h.reserve(client, r.ContentLength)
+	if !ok {
+		http.Error(w, "size limit exceeded", http.StatusRequestEntityTooLarge)
+		return
+	}
+	counted := &countingReader{r: http.MaxBytesReader(w, r.Body, reserved)}
+	defer func() { h.refund(client, reserved-counted.n) }()
+
+	var body io.Reader = counted
+	switch r.Header.Get("Content-Encoding") {
+	case "", "identity":
+	case "gzip":
+		gz, err := gzip.NewReader(counted)
+		if err != nil {
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return
+		}
+		defer gz.Close()
+		body = gz
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return
+	}
+	body = &limitedReader{r: body, remaining: h.maxDecompressed}
+
+	// Lines already read are kept when the body turns out to be bad.
+	var result IngestResult
+	status := http.StatusOK
+	pending := lineBuffer{maxLength: DefaultMaxLineLength}
+	reader := bufio.NewReader(body)
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		pending.add(chunk)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == nil || pending.size > 0 {
+			if line, ok := pending.line(); !ok {
+				result.Rejected++
+			} else if line != "" {
+				h.process(line, &result)
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			if _, ok := err.(*http.MaxBytesError); ok || err == errDecompressedTooLarge {
+				status = http.StatusRequestEntityTooLarge
+				result.Error = "size limit exceeded"
+			} else {
+				status = http.StatusBadRequest
+				result.Error = "could not read body"
+			}
+			break
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(result)
+}
+
+// SetMaxDecompressedBytes sets the most bytes read from one decompressed body.
+// The default is DefaultMaxDecompressedBytes.
+func (h *IngestHandler) SetMaxDecompressedBytes(n int64) {
+	h.maxDecompressed = n
+}
+
+func (h *IngestHandler) process(line string, result *IngestResult) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if err := h.stats.ProcessEntry(&line); err != nil {
+		result.Rejected++
+	} else {
+		result.Accepted++
+	}
+}
+
+// reserve takes bytes for a request from client's allowance in the current
+// window before its body is read, so that concurrent requests can not share
+// the same allowance. It takes contentLength bytes when the length is known
+// and everything that is left otherwise. It returns false when the request does
+// not fit.
+func (h *IngestHandler) reserve(client string, contentLength int64) (int64, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if time.Since(h.windowStart) >= h.window {
+		h.windowStart = time.Now()
+		h.used = make(map[string]int64)
+	}
+	remaining := h.maxBytes - h.used[client]
+	if remaining <= 0 || contentLength > remaining {
+		return 0, false
+	}
+	n := remaining
+	if contentLength >= 0 {
+		n = contentLength
+	}
+	h.used[client] += n
+	return n, true
+}
+
+// refund gives back the part of a reservation that was not used.
+func (h *IngestHandler) refund(client string, n int64) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if n > 0 && h.used[client] >= n {
+		h.used[client] -= n
+	}
+}
+
+// limitedReader reads at most remaining bytes from r, and then fails with
+// errDecompressedTooLarge if there is more.
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining <= 0 {
+		var b [1]byte
+		n, err := l.r.Read(b[:])
+		if n > 0 {
+			return 0, errDecompressedTooLarge
+		}
+		return 0, err
+	}
+	if int64(len(p)) > l.remaining {
+		p = p[:l.remaining]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	return n, err
+}
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
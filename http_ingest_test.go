@@ -0,0 +1,181 @@
+package monitor
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func postLines(t *testing.T, h http.Handler, token string, body []byte, gzipped bool) (*httptest.ResponseRecorder, IngestResult) {
+	req := httptest.NewRequest(http.MethodPost, "/ingest", bytes.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if gzipped {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+
+	var result IngestResult
+	if rec.Header().Get("Content-Type") == "application/json" {
+		if err := json.Unmarshal(rec.Body.Bytes(), &result); err != nil {
+			t.Errorf("Could not decode the response %q! %s", rec.Body.String(), err)
+		}
+	}
+	return rec, result
+}
+
+var ingestBody = strings.Join([]string{
+	`127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "POST http://my.site.com/pages/create HTTP/1.0" 200 2326`,
+	"This is not a properly formatted string",
+	`127.0.0.1 user-identifier frank [10/Oct/2000:13:55:37 -0700] "POST http://my.site.com/pets/create HTTP/1.0" 200 2326`,
+}, "\n") + "\n"
+
+func TestIngestHandler(t *testing.T) {
+	stats := NewLogStatsDefault("my.site.com")
+	h := NewIngestHandler(stats, "secret", 1<<20, time.Minute)
+
+	rec, result := postLines(t, h, "secret", []byte(ingestBody), false)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 but got %d: %s", rec.Code, rec.Body.String())
+		t.FailNow()
+	}
+	if result.Accepted != 2 || result.Rejected != 1 {
+		t.Errorf("Expected 2 accepted and 1 rejected but got %+v", result)
+	}
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(ingestBody))
+	gz.Close()
+	rec, result = postLines(t, h, "secret", buf.Bytes(), true)
+	if rec.Code != http.StatusOK || result.Accepted != 2 {
+		t.Errorf("Expected the gzip body to be accepted but got %d %+v", rec.Code, result)
+	}
+
+	if stats.TotalSiteRequests() != 4 {
+		t.Errorf("Expected 4 requests but got %d instead.", stats.TotalSiteRequests())
+	}
+}
+
+func TestIngestHandlerAuth(t *testing.T) {
+	h := NewIngestHandler(NewLogStatsDefault("my.site.com"), "secret", 1<<20, time.Minute)
+	rec, _ := postLines(t, h, "wrong", []byte(ingestBody), false)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected status 401 but got %d", rec.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/ingest", nil)
+	req.Header.Set("Authorization", "Bearer secret")
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("Expected status 405 but got %d", rec.Code)
+	}
+
+	h = NewIngestHandler(NewLogStatsDefault("my.site.com"), "", 1<<20, time.Minute)
+	rec, _ = postLines(t, h, "", []byte(ingestBody), false)
+	if rec.Code != http.StatusUnauthorized {
+		t.Errorf("Expected an empty token to be rejected but got %d", rec.Code)
+	}
+}
+
+func TestIngestHandlerSizeLimit(t *testing.T) {
+	limit := int64(len(ingestBody) + 10)
+	h := NewIngestHandler(NewLogStatsDefault("my.site.com"), "secret", limit, time.Hour)
+
+	rec, _ := postLines(t, h, "secret", []byte(ingestBody), false)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected the first body to fit but got %d", rec.Code)
+	}
+	rec, _ = postLines(t, h, "secret", []byte(ingestBody), false)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 once the client is over its limit but got %d", rec.Code)
+	}
+
+	// Another client has its own allowance.
+	req := httptest.NewRequest(http.MethodPost, "/ingest", strings.NewReader(ingestBody))
+	req.Header.Set("Authorization", "Bearer secret")
+	req.RemoteAddr = "10.0.0.2:1234"
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected a different client to be accepted but got %d", rec.Code)
+	}
+}
+
+func TestIngestHandlerDecompressedLimit(t *testing.T) {
+	h := NewIngestHandler(NewLogStatsDefault("my.site.com"), "secret", 1<<20, time.Minute)
+	h.SetMaxDecompressedBytes(1 << 10)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write(bytes.Repeat([]byte("a"), 1<<20))
+	gz.Close()
+	rec, _ := postLines(t, h, "secret", buf.Bytes(), true)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 for a body that decompresses past the limit but got %d", rec.Code)
+	}
+}
+
+func TestIngestHandlerPartialBody(t *testing.T) {
+	stats := NewLogStatsDefault("my.site.com")
+	h := NewIngestHandler(stats, "secret", 1<<20, time.Minute)
+	h.SetMaxDecompressedBytes(int64(len(ingestBody)) + 10)
+
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte(ingestBody))
+	gz.Write(bytes.Repeat([]byte("a"), 1<<10))
+	gz.Close()
+	rec, result := postLines(t, h, "secret", buf.Bytes(), true)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Errorf("Expected status 413 but got %d", rec.Code)
+	}
+	// The line cut off by the limit is rejected.
+	if result.Accepted != 2 || result.Rejected != 2 || result.Error == "" {
+		t.Errorf("Expected the lines read before the limit in the result but got %+v", result)
+	}
+	if stats.TotalSiteRequests() != 2 {
+		t.Errorf("Expected 2 requests but got %d instead.", stats.TotalSiteRequests())
+	}
+}
+
+func TestIngestHandlerLongLine(t *testing.T) {
+	stats := NewLogStatsDefault("my.site.com")
+	h := NewIngestHandler(stats, "secret", 2*DefaultMaxLineLength, time.Minute)
+
+	body := strings.Repeat("a", DefaultMaxLineLength+1) + "\n" + ingestBody
+	rec, result := postLines(t, h, "secret", []byte(body), false)
+	if rec.Code != http.StatusOK {
+		t.Errorf("Expected status 200 but got %d: %s", rec.Code, rec.Body.String())
+		t.FailNow()
+	}
+	if result.Accepted != 2 || result.Rejected != 2 {
+		t.Errorf("Expected 2 accepted and 2 rejected but got %+v", result)
+	}
+}
+
+func TestIngestHandlerReserve(t *testing.T) {
+	h := NewIngestHandler(NewLogStatsDefault("my.site.com"), "secret", 100, time.Hour)
+
+	// A body of unknown length holds the whole allowance until it is read.
+	n, ok := h.reserve("10.0.0.1", -1)
+	if !ok || n != 100 {
+		t.Errorf("Expected to reserve 100 bytes but got %d, %v", n, ok)
+	}
+	if _, ok := h.reserve("10.0.0.1", 10); ok {
+		t.Errorf("Expected a concurrent request to be refused")
+	}
+	h.refund("10.0.0.1", 60)
+	if n, ok := h.reserve("10.0.0.1", 70); ok {
+		t.Errorf("Expected 70 bytes not to fit in the 60 left but reserved %d", n)
+	}
+	if n, ok := h.reserve("10.0.0.1", -1); !ok || n != 60 {
+		t.Errorf("Expected to reserve the 60 bytes left but got %d, %v", n, ok)
+	}
+}
@@ -2,18 +2,22 @@ package monitor
 
 import (
 	"bufio"
+	"bytes"
 	"container/list"
 	"errors"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
-	"regexp"
 	"sort"
-
-	"github.com/acidleroy/logparse"
+	"strings"
+	"time"
 )
 
+// OverallTimeAverage keeps track of the average accesses per minute since the
+// first access. Times are kept in nanoseconds, so accesses within the same
+// second still give a meaningful average.
 type OverallTimeAverage struct {
 	firstTs  *int64
 	lastTs   int64
@@ -21,8 +25,14 @@ type OverallTimeAverage struct {
 	avgMin   float32
 }
 
+// Update updates the average given a unix epoch in seconds.
 func (o *OverallTimeAverage) Update(ts int64) {
+	o.UpdateAt(time.Unix(ts, 0))
+}
 
+// UpdateAt updates the average given the time of an access.
+func (o *OverallTimeAverage) UpdateAt(t time.Time) {
+	ts := t.UnixNano()
 	if o.firstTs == nil {
 		o.firstTs = new(int64)
 		*o.firstTs = ts
@@ -33,14 +43,20 @@ func (o *OverallTimeAverage) Update(ts int64) {
 		if ts > o.lastTs {
 			o.lastTs = ts
 		}
-		denom := float32(o.lastTs - *o.firstTs)
-		if denom != 0 {
-			o.avgMin = float32(60*o.accesses) / denom
-		}
+		o.avgMin = perMinute(o.accesses, o.lastTs-*o.firstTs)
 	}
 	o.accesses++
 }
 
+// perMinute returns how many accesses per minute count accesses over elapsed
+// nanoseconds is, or zero when no time has elapsed.
+func perMinute(count int64, elapsed int64) float32 {
+	if elapsed <= 0 {
+		return 0
+	}
+	return float32(float64(count) * float64(time.Minute) / float64(elapsed))
+}
+
 func NewOverallTimeAverage() *OverallTimeAverage {
 	n := new(OverallTimeAverage)
 	return n
@@ -48,8 +64,8 @@ func NewOverallTimeAverage() *OverallTimeAverage {
 
 // RollingTimeAverage is a struct to keep track of the rolling time average.
 type RollingTimeAverage struct {
-	timeToKeepMin int64 // Time to keep rolling in minutes
-	savedTimes    *list.List
+	timeToKeepMin int64      // Time to keep rolling in minutes
+	savedTimes    *list.List // Access times in nanoseconds
 	avgMin        float32
 }
 
@@ -65,22 +81,23 @@ func NewRollingTimeAverage(timeToRoll int64) *RollingTimeAverage {
 
 // Update Function to update the rolling time average given a unix epoch
 func (r *RollingTimeAverage) Update(ts int64) {
+	r.UpdateAt(time.Unix(ts, 0))
+}
+
+// UpdateAt updates the rolling time average given the time of an access.
+func (r *RollingTimeAverage) UpdateAt(t time.Time) {
+	ts := t.UnixNano()
 	r.savedTimes.PushBack(ts)
 
+	keep := int64(time.Duration(r.timeToKeepMin) * time.Minute)
 	val := r.savedTimes.Front().Value.(int64)
-	for (ts - val) > r.timeToKeepMin*60 {
+	for (ts - val) > keep {
 		r.savedTimes.Remove(r.savedTimes.Front())
 		val = r.savedTimes.Front().Value.(int64)
 	}
 
 	first := r.savedTimes.Front().Value.(int64)
-	denom := float32(ts - first)
-
-	if denom > 0 {
-		r.avgMin = float32(r.savedTimes.Len()-1) * 60.0 / (denom)
-	} else {
-		r.avgMin = 0
-	}
+	r.avgMin = perMinute(int64(r.savedTimes.Len()-1), ts-first)
 }
 
 // SectionStats contains both the rolling average and the overall average for
@@ -89,9 +106,13 @@ type SectionStats struct {
 	sectionName       string
 	totalAccess       int64
 	accessesPerMinute *float32
-	firstAccess       *int64
-	lastAccess        *int64
+	firstAccess       *int64 // Unix time in nanoseconds
+	lastAccess        *int64 // Unix time in nanoseconds
 	rollingAverage    *RollingTimeAverage
+	referers          map[string]int64
+	userAgents        map[string]int64
+	totalDuration     time.Duration
+	timedAccesses     int64
 }
 
 func (s *SectionStats) PrintStats() {
@@ -104,16 +125,36 @@ func (s *SectionStats) PrintStats() {
 		fmt.Println("Rolling average accesses per minute: ", s.rollingAverage.avgMin)
 	}
 	if s.firstAccess != nil {
-		fmt.Println("First Access: ", *s.firstAccess)
+		fmt.Println("First Access: ", time.Unix(0, *s.firstAccess))
 	}
 
 	if s.lastAccess != nil {
-		fmt.Println("Last access: ", *s.lastAccess)
+		fmt.Println("Last access: ", time.Unix(0, *s.lastAccess))
+	}
+
+	if s.timedAccesses > 0 {
+		fmt.Println("Average response time: ", s.AverageDuration())
+	}
+
+	for _, r := range s.TopReferers(3) {
+		fmt.Printf("Referer: %s (%d)\n", r.Name, r.Count)
+	}
+	for _, ua := range s.TopUserAgents(3) {
+		fmt.Printf("User agent: %s (%d)\n", ua.Name, ua.Count)
 	}
 
 	fmt.Println()
 }
 
+// AverageDuration returns the average time taken to serve the requests to the
+// section that logged one, or zero if none did.
+func (s *SectionStats) AverageDuration() time.Duration {
+	if s.timedAccesses == 0 {
+		return 0
+	}
+	return s.totalDuration / time.Duration(s.timedAccesses)
+}
+
 // NewSectionStats creates an object that has statistics about the site. You pass it
 // the name of the section and inject a RollingTimeAverage object.
 func NewSectionStats(sectionName string, rollingAverage *RollingTimeAverage) *SectionStats {
@@ -140,6 +181,11 @@ type LogStats struct {
 	totalSiteRequests int
 	thresholdMin      float32
 	highTrafficAlarm  bool
+	containerRequests map[string]int
+	parser            Parser
+	quarantine        *Quarantine
+	defaultHost       string
+	sectionBuf        []byte // Reused to look up sections without allocating
 }
 
 func (s *LogStats) PrintPopulartSections(num int) {
@@ -158,7 +204,7 @@ func NewLogStats(siteName string, avg *OverallTimeAverage, rollingAvg *RollingTi
 	s := new(LogStats)
 	s.avg = avg
 	s.rollingAvg = rollingAvg
-	s.siteName = siteName
+	s.siteName = normalizeHost(siteName)
 	s.thresholdMin = thresholdMin
 	return s
 }
@@ -174,31 +220,78 @@ func NewLogStatsDefault(siteName string) *LogStats {
 }
 
 // ProcessEntry is a function that processes a single log entry given an string
-// representing that log entry
+// representing that log entry. The entry is parsed with the LogStats' parser.
+// Entries that can not be processed are also sent to the quarantine, if set.
 func (stats *LogStats) ProcessEntry(e *string) error {
-	l, err := logparse.Common(*e)
-	if err != nil {
-		return err
-	}
+	return stats.ProcessEntryAt("", -1, e)
+}
 
-	if l.Request.URL.Hostname() != stats.siteName {
-		log.Printf("site %s != %s\n", l.Request.URL.Hostname(), stats.siteName)
+// ProcessRecord updates the statistics with an already parsed request. Records
+// without a URL or a time are rejected.
+func (stats *LogStats) ProcessRecord(r *AccessRecord) error {
+	if r.URL == nil {
+		return ErrMissingURL
+	}
+	if r.Time.IsZero() {
+		return ErrMissingTime
+	}
+	host := recordHost(r, stats.defaultHost)
+	if host != stats.siteName {
+		log.Printf("site %s != %s\n", host, stats.siteName)
 		return nil
 	}
 
+	log.Println("The site is: ", host)
+	log.Println("The request is = ", r.Method, r.URL)
+
+	elem := stats.lookupSection(host, r.URL.EscapedPath())
+	stats.countAccess(elem, r.Time, r.Referer, r.UserAgent, r.Duration, r.HasDuration)
+	return nil
+}
+
+// recordHost returns the site a request was for: the host logged with it, the
+// host in its URL, or defaultHost when the URL is just a path. Logged hosts
+// are normalized with normalizeHost.
+func recordHost(r *AccessRecord, defaultHost string) string {
+	if r.Host != "" {
+		return normalizeHost(r.Host)
+	}
+	if host := r.URL.Hostname(); host != "" {
+		return strings.ToLower(host)
+	}
+	return defaultHost
+}
+
+// normalizeHost returns a host, as logged from a Host header or a URL, in the
+// form sites are compared in: lower case, without a port and without the
+// brackets around an IPv6 address.
+func normalizeHost(host string) string {
+	if strings.HasPrefix(host, "[") {
+		if i := strings.IndexByte(host, ']'); i > 0 {
+			host = host[1:i]
+		}
+	} else if i := strings.LastIndexByte(host, ':'); i >= 0 && strings.IndexByte(host, ':') == i {
+		// More than one colon is an IPv6 address without a port.
+		host = host[:i]
+	}
+	return strings.ToLower(host)
+}
+
+// lookupSection returns the statistics for the section of path on host,
+// adding them if the section has never been accessed. The section's name is
+// built in a buffer kept between calls so that finding an existing section
+// does not allocate.
+func (stats *LogStats) lookupSection(host string, path string) *SectionStats {
 	if stats.sectionStats == nil {
 		log.Println("Creating site stats map!")
 		m := make(map[string]*SectionStats) //TODO: Initialize in constructor
 		stats.sectionStats = m
 	}
 
-	log.Println("The site is: ", l.Request.URL.Hostname())
-	log.Println("The entry is = ", *e)
-
-	section := GetSectionFromURL(l.Request.URL.String())
-
-	elem, ok := stats.sectionStats[section]
+	stats.sectionBuf = appendSection(stats.sectionBuf[:0], host, path)
+	elem, ok := stats.sectionStats[string(stats.sectionBuf)]
 	if !ok {
+		section := string(stats.sectionBuf)
 		log.Println("Section ", section, " has never been accessed, adding it.")
 		roll := NewRollingTimeAverage(2)
 		tmp := NewSectionStats(section, roll)
@@ -207,22 +300,44 @@ func (stats *LogStats) ProcessEntry(e *string) error {
 		stats.sortedSections = append(stats.sortedSections, tmp)
 
 	}
+	return elem
+}
 
-	stats.rollingAvg.Update(l.Time.Unix())
-	stats.avg.Update(l.Time.Unix())
-	UpdateSectionStats(elem, l.Time.Unix())
+// countAccess updates the statistics with an access to a section of the site.
+// The duration d only counts when timed is set.
+func (stats *LogStats) countAccess(elem *SectionStats, t time.Time, referer string, userAgent string, d time.Duration, timed bool) {
+	stats.rollingAvg.UpdateAt(t)
+	stats.avg.UpdateAt(t)
+	UpdateSectionStatsAt(elem, t)
+	elem.recordClient(referer, userAgent)
+	if timed {
+		elem.totalDuration += d
+		elem.timedAccesses++
+	}
 	stats.totalSiteRequests++
 
 	if (stats.rollingAvg.avgMin > stats.thresholdMin) && (stats.highTrafficAlarm == false) {
-		fmt.Println("SITE RECEIVING HIGH TRAFFIC!!!!!")
+		fmt.Println("SITE", stats.siteName, "RECEIVING HIGH TRAFFIC!!!!!")
 		stats.highTrafficAlarm = true
 	}
 
 	if (stats.rollingAvg.avgMin <= stats.thresholdMin) && (stats.highTrafficAlarm == true) {
-		fmt.Println("SITE TRAFFIC RETURNING TO NORMAL!!")
+		fmt.Println("SITE", stats.siteName, "TRAFFIC RETURNING TO NORMAL!!")
 		stats.highTrafficAlarm = false
 	}
-	return nil
+}
+
+// SetDefaultHost sets the host of requests whose target is just a path and
+// that were logged without a Host or virtual host field. Without it such
+// requests are not counted towards the site.
+func (stats *LogStats) SetDefaultHost(host string) {
+	stats.defaultHost = normalizeHost(host)
+}
+
+// HighTrafficAlarm reports whether the site's rolling average is above the
+// alarm threshold.
+func (stats *LogStats) HighTrafficAlarm() bool {
+	return stats.highTrafficAlarm
 }
 
 //TotalSiteRequests returns the total number of requests made to the site.
@@ -233,7 +348,10 @@ func (stats *LogStats) TotalSiteRequests() int {
 // AccessesPerMinute returns the total number of accesses per minute
 func (stats *LogStats) AccessesPerMinute(s string) (float32, error) {
 	elem, ok := stats.sectionStats[s]
-	if ok {
+	if ok && elem.accessesPerMinute == nil {
+		// A single access has no average yet.
+		return 0, nil
+	} else if ok {
 		return *elem.accessesPerMinute, nil
 	}
 	return -1.0, errors.New("Section " + s + " doesn't exist!")
@@ -252,70 +370,345 @@ func (stats *LogStats) PopularSections() []*SectionStats {
 
 //UpdateSectionStats updates the statistics each time a new entry is encountered.
 func UpdateSectionStats(stats *SectionStats, ts int64) {
+	UpdateSectionStatsAt(stats, time.Unix(ts, 0))
+}
 
+// UpdateSectionStatsAt updates the statistics given the time of a new entry.
+func UpdateSectionStatsAt(stats *SectionStats, t time.Time) {
+	ts := t.UnixNano()
 	if stats.firstAccess == nil {
 		stats.firstAccess = &ts
 	} else {
 		stats.lastAccess = &ts
-		avg := float32(stats.totalAccess) * 60.0 / float32(*stats.lastAccess-*stats.firstAccess)
+		avg := perMinute(stats.totalAccess, *stats.lastAccess-*stats.firstAccess)
 		stats.accessesPerMinute = &avg
 	}
 	stats.totalAccess++
-	stats.rollingAverage.Update(ts)
+	stats.rollingAverage.UpdateAt(t)
 }
 
-var re = regexp.MustCompile(`(http:\/\/)?(.+)(\/.*)`)
-
-// GetSectionFromURL returns a string representing the site
+// GetSectionFromURL returns the section of a request target: everything before
+// the last "/" of the target without its scheme. The target may be an absolute
+// URL, such as "http://my.site.com/a/b/c" whose section is "my.site.com/a/b",
+// or just a path, such as "/pages/create" whose section is "/pages".
 func GetSectionFromURL(url string) string {
-	res := re.FindStringSubmatch(url)
-	return res[2]
+	return SectionOf(splitTarget(url))
 }
 
-// LogReader is a struct that contains some basic information about the file
+// SectionOf returns the section of a request for path on host, as
+// GetSectionFromURL does for the URL made of them. The query and fragment of
+// path are left out.
+func SectionOf(host string, path string) string {
+	return string(appendSection(nil, host, path))
+}
+
+func appendSection(b []byte, host string, path string) []byte {
+	if i := strings.IndexAny(path, "?#"); i >= 0 {
+		path = path[:i]
+	}
+	if i := strings.LastIndexByte(path, '/'); i >= 0 {
+		path = path[:i]
+	}
+	b = append(b, host...)
+	return append(b, path...)
+}
+
+// splitTarget splits a request target into the host of an absolute URL,
+// normalized with normalizeHost, and the rest of the target. The host of a
+// target that is just a path is empty.
+func splitTarget(target string) (string, string) {
+	scheme := strings.Index(target, "://")
+	if scheme < 0 || strings.IndexByte(target[:scheme], '/') >= 0 {
+		return "", target
+	}
+	rest := target[scheme+len("://"):]
+	host, path := rest, ""
+	if i := strings.IndexAny(rest, "/?#"); i >= 0 {
+		host, path = rest[:i], rest[i:]
+	}
+	if i := strings.LastIndexByte(host, '@'); i >= 0 {
+		host = host[i+1:]
+	}
+	return normalizeHost(host), path
+}
+
+// DefaultMaxBatchSize is the most lines a LogReader returns from one call to
+// GetNewLogEntries unless told otherwise. The rest are returned by later calls.
+const DefaultMaxBatchSize = 10000
+
+// DefaultMaxLineLength is the longest line, in bytes, a LogReader returns
+// unless told otherwise.
+const DefaultMaxLineLength = 1024 * 1024
+
+// LogReader is a struct that contains some basic information about the file.
+// It keeps the file open between calls so that it can finish reading a file
+// that has been rotated away before moving on to its replacement.
 type LogReader struct {
 	fileName string
-	lastSize int64
+	lastSize int64      // Offset into the currently open file
+	pending  lineBuffer // Unterminated line at the end of the last read
+	maxBatch int
+	file     *os.File
+	identity fileIdentity
+	notifier changeNotifier
+	decoder  LineDecoder
+	decoded  int64 // Offset of the first record of the line being decoded, or -1
+
+	checkpointFile     string
+	checkpointInterval time.Duration
+	lastCheckpoint     time.Time
+}
+
+// fileIdentity is the device and inode pair of a file. It stays the same when
+// a file is renamed, and changes when a new file is created in its place.
+type fileIdentity struct {
+	Device uint64
+	Inode  uint64
 }
 
 // NewLogReader constructs a new log reader object
 func NewLogReader(fName string) *LogReader {
 	r := new(LogReader)
 	r.fileName = fName
+	r.maxBatch = DefaultMaxBatchSize
+	r.pending.maxLength = DefaultMaxLineLength
 	// fmt.Println("The filename = ", r.fileName)
 	return r
 }
 
+// SetMaxBatchSize sets the most lines GetNewLogEntries returns at once. Zero
+// means no limit.
+func (l *LogReader) SetMaxBatchSize(n int) {
+	l.maxBatch = n
+}
+
+// SetMaxLineLength sets the longest line, in bytes, the reader returns. Longer
+// lines are cut down to n bytes when truncate is set, and skipped otherwise.
+// Either way they are counted by OversizedLines. Zero means no limit.
+func (l *LogReader) SetMaxLineLength(n int, truncate bool) {
+	l.pending.maxLength = n
+	l.pending.truncate = truncate
+	l.limitDecoder()
+}
+
+// OversizedLines returns how many lines were longer than the maximum line length.
+func (l *LogReader) OversizedLines() int {
+	if p, ok := l.decoder.(partialLines); ok {
+		return l.pending.oversized + p.partialBuffer().oversized
+	}
+	return l.pending.oversized
+}
+
 // GetNewLogEntries returns a a slice of new strings that have been appended to
-// the file
+// the file. Only complete, newline terminated lines are returned; a line that is
+// still being written is held back until the rest of it arrives. If the file
+// was rotated (moved aside and recreated) since the last call, the rest of the
+// old file is read first, followed by the new file from the beginning. If the
+// file was truncated in place, reading restarts at the beginning of the file.
 func (l *LogReader) GetNewLogEntries() ([]string, error) {
+	entries, err := l.GetNewEntries()
+	return entryTexts(entries), err
+}
 
-	info, err1 := os.Lstat(l.fileName)
+// GetNewEntries works like GetNewLogEntries, returning each line along with
+// the file name and the offset of the line in the file it was read from.
+func (l *LogReader) GetNewEntries() ([]LogEntry, error) {
+	entries, err := l.getNewLogEntries()
+	entries = l.decode(entries)
+	if err == nil && len(entries) > 0 {
+		err = l.maybeSaveCheckpoint()
+	}
+	return entries, err
+}
+
+func (l *LogReader) getNewLogEntries() ([]LogEntry, error) {
+
+	info, err1 := os.Stat(l.fileName)
 
 	if err1 != nil {
+		if l.file != nil && os.IsNotExist(err1) {
+			// Moved away but not recreated yet, keep draining the old file.
+			entries, _, err := l.readLines(l.maxBatch)
+			return entries, err
+		}
 		return nil, err1
 	}
 
-	fSize := info.Size()
+	if l.file == nil {
+		if err := l.open(); err != nil {
+			return nil, err
+		}
+	} else if identityOf(info) != l.identity {
+		log.Println("Log file ", l.fileName, " was rotated, finishing the old file.")
+		entries, done, err := l.readLines(l.maxBatch)
+		if err != nil || !done {
+			// The rest of the old file is read by the next call.
+			return entries, err
+		}
+		// Nothing more will be written to the old file.
+		entries = append(entries, l.flush()...)
+		l.file.Close()
+		l.file = nil
+		if err = l.open(); err != nil {
+			return entries, err
+		}
+		if l.maxBatch > 0 && len(entries) >= l.maxBatch {
+			return entries, nil
+		}
+		more, _, err := l.readLines(l.maxBatch - len(entries))
+		return append(entries, more...), err
+	} else if info.Size() < l.lastSize {
+		log.Println("Log file ", l.fileName, " was truncated, starting from the beginning.")
+		l.lastSize = 0
+		l.pending.reset()
+	}
 
-	if fSize <= l.lastSize {
+	if info.Size() <= l.lastSize {
 		//log.Println("The were no changes to the file!")
 		return nil, nil
 	}
 
+	entries, _, err := l.readLines(l.maxBatch)
+	return entries, err
+}
+
+// Close closes the file currently being read and stops watching it for changes.
+// If the reader keeps a checkpoint, its final position is saved first.
+func (l *LogReader) Close() error {
+	err := l.SaveCheckpoint()
+	if l.notifier != nil {
+		if nerr := l.notifier.close(); nerr != nil {
+			err = nerr
+		}
+		l.notifier = nil
+	}
+	if l.file != nil {
+		if cerr := l.file.Close(); cerr != nil {
+			err = cerr
+		}
+		l.file = nil
+	}
+	return err
+}
+
+// open opens fileName and records its identity. Reading starts at offset zero.
+func (l *LogReader) open() error {
 	f, err := os.Open(l.fileName)
 	if err != nil {
-		return nil, err
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
 	}
-	defer f.Close()
+	l.file = f
+	l.identity = identityOf(info)
+	l.lastSize = 0
+	l.pending.reset()
+	return nil
+}
 
+// Flush returns the unterminated line held back from the end of the file, if
+// there is one. Call it once no more input is expected.
+func (l *LogReader) Flush() []string {
+	return entryTexts(l.flush())
+}
+
+func (l *LogReader) flush() []LogEntry {
+	if l.pending.size == 0 {
+		return nil
+	}
+	if e, ok := l.pendingEntry(); ok {
+		return []LogEntry{e}
+	}
+	return nil
+}
+
+// pendingEntry ends the line in the pending buffer, which ends at lastSize.
+func (l *LogReader) pendingEntry() (LogEntry, bool) {
+	offset := l.lastSize - l.pending.size
+	line, ok := l.pending.line()
+	return LogEntry{Source: l.fileName, Text: line, Offset: offset}, ok
+}
+
+// readLines reads up to limit lines, or every line when limit is zero, from
+// the end of the last read. It reports whether it reached the end of the file.
+func (l *LogReader) readLines(limit int) ([]LogEntry, bool, error) {
 	// Go to the end of the last read
-	f.Seek(l.lastSize, 0)
-	var entries []string
-	scanner := bufio.NewScanner(f)
-	for scanner.Scan() {
-		entries = append(entries, scanner.Text())
-	}
-	l.lastSize = fSize
-	return entries, nil
+	if _, err := l.file.Seek(l.lastSize, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	var entries []LogEntry
+	reader := bufio.NewReader(l.file)
+	for limit <= 0 || len(entries) < limit {
+		chunk, err := reader.ReadSlice('\n')
+		l.lastSize += int64(len(chunk))
+		l.pending.add(chunk)
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == io.EOF {
+			return entries, true, nil
+		}
+		if err != nil {
+			return entries, false, err
+		}
+		if e, ok := l.pendingEntry(); ok {
+			entries = append(entries, e)
+		}
+	}
+	return entries, false, nil
+}
+
+// entryTexts returns the text of each entry.
+func entryTexts(entries []LogEntry) []string {
+	if entries == nil {
+		return nil
+	}
+	texts := make([]string, len(entries))
+	for i, e := range entries {
+		texts[i] = e.Text
+	}
+	return texts
+}
+
+// lineBuffer assembles a line from the pieces returned by bufio.Reader's
+// ReadSlice, holding on to no more than maxLength bytes of it however long the
+// line turns out to be.
+type lineBuffer struct {
+	maxLength int // Zero for no limit
+	truncate  bool
+	buf       []byte
+	size      int64 // Bytes of the current line seen so far
+	oversized int   // Lines longer than maxLength
+}
+
+func (b *lineBuffer) add(chunk []byte) {
+	b.size += int64(len(chunk))
+	// Keep room for a "\r\n" so a line of exactly maxLength is not cut short.
+	if b.maxLength > 0 && len(b.buf)+len(chunk) > b.maxLength+2 {
+		chunk = chunk[:b.maxLength+2-len(b.buf)]
+	}
+	b.buf = append(b.buf, chunk...)
+}
+
+// line ends the current line and returns it, without its line ending. It
+// returns false when the line was too long and is to be skipped.
+func (b *lineBuffer) line() (string, bool) {
+	text := bytes.TrimSuffix(bytes.TrimSuffix(b.buf, []byte("\n")), []byte("\r"))
+	ok := true
+	if b.maxLength > 0 && len(text) > b.maxLength {
+		b.oversized++
+		text = text[:b.maxLength]
+		ok = b.truncate
+	}
+	line := string(text)
+	b.reset()
+	return line, ok
+}
+
+func (b *lineBuffer) reset() {
+	b.buf = b.buf[:0]
+	b.size = 0
 }
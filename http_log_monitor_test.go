@@ -4,7 +4,10 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/acidleroy/logparse"
 )
@@ -113,7 +116,7 @@ func TestUpdateSectionStats(t *testing.T) {
 	UpdateSectionStats(s, ts)
 	ts++
 	UpdateSectionStats(s, ts)
-	if *s.firstAccess != 1 {
+	if *s.firstAccess != int64(time.Second) {
 		t.Errorf("The first access should be zero and instead it is: %d.", s.firstAccess)
 	}
 
@@ -413,3 +416,386 @@ func TestPrintStats(t *testing.T) {
 	stats.PrintPopulartSections(10)
 
 }
+
+func appendLines(fName string, lines ...string) error {
+	f, err := os.OpenFile(fName, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for _, line := range lines {
+		if _, err := f.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeLines(t *testing.T, fName string, lines ...string) {
+	if err := appendLines(fName, lines...); err != nil {
+		t.Errorf("There was an issue writing to the file! %s", err)
+		t.FailNow()
+	}
+}
+
+func TestLogReaderRotation(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one", "two")
+
+	r := NewLogReader(fName)
+	defer r.Close()
+	entries, err := r.GetNewLogEntries()
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected 2 entries but got %d (%v)", len(entries), err)
+		t.FailNow()
+	}
+
+	// Rotate like logrotate does by default: the old file is moved aside,
+	// written to a little more and a new file is created in its place.
+	if err := os.Rename(fName, fName+".1"); err != nil {
+		t.Errorf("Could not rotate the file! %s", err)
+		t.FailNow()
+	}
+	writeLines(t, fName+".1", "three")
+	writeLines(t, fName, "four")
+
+	entries, err = r.GetNewLogEntries()
+	if err != nil {
+		t.Errorf("There was an error reading the rotated file! %s", err)
+		t.FailNow()
+	}
+	expected := []string{"three", "four"}
+	if len(entries) != len(expected) {
+		t.Errorf("Expected %v but got %v instead.", expected, entries)
+		t.FailNow()
+	}
+	for i := range expected {
+		if expected[i] != entries[i] {
+			t.Errorf("Expected %s but got %s instead.", expected[i], entries[i])
+		}
+	}
+
+	writeLines(t, fName, "five")
+	entries, _ = r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "five" {
+		t.Errorf("Expected to keep reading the new file but got %v", entries)
+	}
+}
+
+func TestLogReaderCopyTruncate(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one", "two", "three")
+
+	r := NewLogReader(fName)
+	defer r.Close()
+	entries, _ := r.GetNewLogEntries()
+	if len(entries) != 3 {
+		t.Errorf("Expected 3 entries but got %d", len(entries))
+		t.FailNow()
+	}
+
+	if err := os.Truncate(fName, 0); err != nil {
+		t.Errorf("Could not truncate the file! %s", err)
+		t.FailNow()
+	}
+	writeLines(t, fName, "four")
+
+	entries, err := r.GetNewLogEntries()
+	if err != nil {
+		t.Errorf("There was an error reading the truncated file! %s", err)
+		t.FailNow()
+	}
+	if len(entries) != 1 || entries[0] != "four" {
+		t.Errorf("Expected to start over after truncation but got %v", entries)
+	}
+}
+
+func TestLogReaderPartialLines(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	f, err := os.Create(fName)
+	if err != nil {
+		t.Errorf("There was an issue opening the file! %s", err)
+		t.FailNow()
+	}
+	defer f.Close()
+
+	r := NewLogReader(fName)
+	defer r.Close()
+
+	f.WriteString("one\ntw")
+	entries, _ := r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "one" {
+		t.Errorf("Expected only the complete line but got %v", entries)
+	}
+
+	f.WriteString("o\r\nthr")
+	entries, _ = r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "two" {
+		t.Errorf("Expected the partial line to be completed but got %v", entries)
+	}
+
+	f.WriteString("ee")
+	entries, _ = r.GetNewLogEntries()
+	if entries != nil {
+		t.Errorf("Expected no entries without a newline but got %v", entries)
+	}
+	if c := r.Checkpoint(); c.Offset != int64(len("one\ntwo\r\n")) {
+		t.Errorf("The checkpoint should not include the partial line, got offset %d", c.Offset)
+	}
+
+	entries = r.Flush()
+	if len(entries) != 1 || entries[0] != "three" {
+		t.Errorf("Expected flush to return [three] but got %v", entries)
+	}
+	if r.Flush() != nil {
+		t.Errorf("Nothing should be left after a flush!")
+	}
+}
+
+func TestLogReaderRotationPartialLine(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	os.WriteFile(fName, []byte("one\ntwo"), 0644)
+
+	r := NewLogReader(fName)
+	defer r.Close()
+	r.GetNewLogEntries()
+
+	os.Rename(fName, fName+".1")
+	writeLines(t, fName, "three")
+
+	entries, _ := r.GetNewLogEntries()
+	expected := []string{"two", "three"}
+	if len(entries) != 2 || entries[0] != expected[0] || entries[1] != expected[1] {
+		t.Errorf("Expected %v but got %v instead.", expected, entries)
+	}
+}
+
+func TestLogReaderMaxBatchSize(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one", "two", "three", "four", "five")
+
+	r := NewLogReader(fName)
+	defer r.Close()
+	r.SetMaxBatchSize(2)
+
+	var batches [][]string
+	for {
+		entries, err := r.GetNewLogEntries()
+		if err != nil {
+			t.Errorf("There was an error reading the file! %s", err)
+			t.FailNow()
+		}
+		if entries == nil {
+			break
+		}
+		batches = append(batches, entries)
+	}
+	if len(batches) != 3 || len(batches[0]) != 2 || len(batches[2]) != 1 || batches[2][0] != "five" {
+		t.Errorf("Expected batches of at most 2 lines but got %v", batches)
+	}
+}
+
+func TestLogReaderMaxBatchSizeRotation(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one")
+
+	r := NewLogReader(fName)
+	defer r.Close()
+	r.SetMaxBatchSize(2)
+	r.GetNewLogEntries()
+
+	writeLines(t, fName, "two", "three", "four")
+	os.Rename(fName, fName+".1")
+	writeLines(t, fName, "five")
+
+	var all []string
+	for i := 0; i < 4; i++ {
+		entries, _ := r.GetNewLogEntries()
+		if len(entries) > 2 {
+			t.Errorf("Expected at most 2 lines but got %v", entries)
+		}
+		all = append(all, entries...)
+	}
+	expected := []string{"two", "three", "four", "five"}
+	if len(all) != len(expected) {
+		t.Errorf("Expected %v but got %v instead.", expected, all)
+		t.FailNow()
+	}
+	for i := range expected {
+		if expected[i] != all[i] {
+			t.Errorf("Expected %s but got %s instead.", expected[i], all[i])
+		}
+	}
+}
+
+func TestLogReaderLongLines(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	long := strings.Repeat("x", 100000)
+	writeLines(t, fName, "short", long, "after")
+
+	r := NewLogReader(fName)
+	defer r.Close()
+	entries, err := r.GetNewLogEntries()
+	if err != nil || len(entries) != 3 || entries[1] != long {
+		t.Errorf("Expected a long line to be read whole but got %d entries (%v)", len(entries), err)
+	}
+
+	writeLines(t, fName, long, "1234567890", "last")
+	r.SetMaxLineLength(10, false)
+	entries, _ = r.GetNewLogEntries()
+	if len(entries) != 2 || entries[0] != "1234567890" || entries[1] != "last" {
+		t.Errorf("Expected the oversized line to be skipped but got %v", entries)
+	}
+
+	writeLines(t, fName, long+"\r")
+	r.SetMaxLineLength(10, true)
+	entries, _ = r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "xxxxxxxxxx" {
+		t.Errorf("Expected the oversized line to be truncated but got %v", entries)
+	}
+	if r.OversizedLines() != 2 {
+		t.Errorf("Expected 2 oversized lines but got %d", r.OversizedLines())
+	}
+
+	f, _ := os.OpenFile(fName, os.O_APPEND|os.O_WRONLY, 0644)
+	f.WriteString(long)
+	f.Close()
+	r.GetNewLogEntries()
+	if c := r.Checkpoint(); c.Offset != int64(len("short\nafter\n1234567890\nlast\n")+3*(len(long)+1)+1) {
+		t.Errorf("A held back oversized line should not be counted in the checkpoint, got offset %d", c.Offset)
+	}
+}
+
+func TestSubSecondAverages(t *testing.T) {
+	start := time.Unix(1000, 0)
+	o := NewOverallTimeAverage()
+	r := NewRollingTimeAverage(1)
+	s := NewSectionStats("test", NewRollingTimeAverage(1))
+	for i := 0; i < 4; i++ {
+		ts := start.Add(time.Duration(i) * 250 * time.Millisecond)
+		o.UpdateAt(ts)
+		r.UpdateAt(ts)
+		UpdateSectionStatsAt(s, ts)
+	}
+
+	// 3 accesses after the first in 0.75 seconds
+	expected := float32(240.0)
+	if o.avgMin != expected || r.avgMin != expected || *s.accessesPerMinute != expected {
+		t.Errorf("Expected %f accesses per minute but got %f, %f and %f", expected, o.avgMin, r.avgMin, *s.accessesPerMinute)
+	}
+}
+
+func TestSameInstantAverages(t *testing.T) {
+	s := NewSectionStats("test", NewRollingTimeAverage(1))
+	now := time.Now()
+	UpdateSectionStatsAt(s, now)
+	UpdateSectionStatsAt(s, now)
+	if *s.accessesPerMinute != 0 || s.rollingAverage.avgMin != 0 {
+		t.Errorf("Expected no average for accesses at the same instant but got %f and %f", *s.accessesPerMinute, s.rollingAverage.avgMin)
+	}
+}
+
+func TestGetSectionFromOriginForm(t *testing.T) {
+	tests := map[string]string{
+		"http://my.site.com/pages/create":      "my.site.com/pages",
+		"http://my.site.com/a/b/c":             "my.site.com/a/b",
+		"https://My.Site.com:8443/pages/a/b/c": "my.site.com/pages/a/b",
+		"http://my.site.com/pages/?x=1/2":      "my.site.com/pages",
+		"http://my.site.com":                   "my.site.com",
+		"http://my.site.com/":                  "my.site.com",
+		"/pages/create":                        "/pages",
+		// Without a host there is nothing left of a target in the root.
+		"/pages": "",
+		"/":      "",
+	}
+	for target, expected := range tests {
+		if actual := GetSectionFromURL(target); actual != expected {
+			t.Errorf("Expected %s for %q but got %s", expected, target, actual)
+		}
+	}
+	if section := SectionOf("my.site.com", "/pages/create"); section != "my.site.com/pages" {
+		t.Errorf("Expected my.site.com/pages but got %s", section)
+	}
+}
+
+func TestHostWithPort(t *testing.T) {
+	p, _ := NewJSONParser("app", testJSONMapping)
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(p)
+	for _, line := range []string{
+		`{"ts": 1792137600, "request": {"host": "My.Site.com:8080", "uri": "/pages/a"}}`,
+		`{"ts": 1792137601, "request": {"host": "my.site.com", "uri": "/pages/b"}}`,
+		`{"ts": 1792137602, "request": {"host": "[::1]:8443", "uri": "/pages/c"}}`,
+	} {
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if _, err := stats.AccessesPerMinute("my.site.com/pages"); err != nil || stats.TotalSiteRequests() != 2 {
+		t.Errorf("Expected both requests for my.site.com to count! %v", err)
+	}
+
+	for host, expected := range map[string]string{
+		"my.site.com:8080": "my.site.com",
+		"MY.SITE.COM":      "my.site.com",
+		"[::1]:8443":       "::1",
+		"[::1]":            "::1",
+		"::1":              "::1",
+	} {
+		if actual := normalizeHost(host); actual != expected {
+			t.Errorf("Expected %s for %s but got %s", expected, host, actual)
+		}
+	}
+}
+
+func TestSiteNameCase(t *testing.T) {
+	line := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET http://My.Site.com/pages/create HTTP/1.0" 200 10 "-" "curl"`
+	for _, p := range []Parser{CombinedParser{}, NewFastParser()} {
+		stats := NewLogStatsDefault("My.Site.com")
+		stats.SetParser(p)
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+		if stats.TotalSiteRequests() != 1 {
+			t.Errorf("Expected the request to count with %s but got %d", p.Name(), stats.TotalSiteRequests())
+		}
+	}
+}
+
+func TestOriginFormHostResolution(t *testing.T) {
+	origin := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /pages/create HTTP/1.0" 200 2326`
+	stats := NewLogStatsDefault("my.site.com")
+	if err := stats.ProcessEntry(&origin); err != nil {
+		t.Errorf("Failed to process log entry! %s", err)
+	}
+	if stats.TotalSiteRequests() != 0 {
+		t.Errorf("Expected the request to be dropped without a default host!")
+	}
+
+	stats.SetDefaultHost("my.site.com")
+	if err := stats.ProcessEntry(&origin); err != nil {
+		t.Errorf("Failed to process log entry! %s", err)
+	}
+	if _, err := stats.AccessesPerMinute("my.site.com/pages"); err != nil || stats.TotalSiteRequests() != 1 {
+		t.Errorf("Expected the request to count towards my.site.com/pages! %v", err)
+	}
+
+	// A virtual host field wins over the default host.
+	vhost, err := LookupParser("apache:vhost_combined")
+	if err != nil {
+		t.Errorf("Failed to find the vhost_combined parser! %s", err)
+		t.FailNow()
+	}
+	stats.SetParser(vhost)
+	for _, line := range []string{
+		`my.site.com:80 127.0.0.1 - - [10/Oct/2000:13:55:37 -0700] "GET /store/buy HTTP/1.0" 200 2326 "-" "curl"`,
+		`other.site.com:80 127.0.0.1 - - [10/Oct/2000:13:55:38 -0700] "GET /store/buy HTTP/1.0" 200 2326 "-" "curl"`,
+	} {
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if _, err := stats.AccessesPerMinute("my.site.com/store"); err != nil || stats.TotalSiteRequests() != 2 {
+		t.Errorf("Expected only the request for my.site.com to count! %v", err)
+	}
+}
@@ -0,0 +1,94 @@
+package monitor
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+	"unsafe"
+)
+
+// inotifyNotifier wakes up when the kernel reports a change to the log file or
+// a new file appearing in its directory.
+type inotifyNotifier struct {
+	fd       int
+	file     *os.File
+	fileName string
+	baseName string
+	buf      [64 * (syscall.SizeofInotifyEvent + syscall.NAME_MAX + 1)]byte
+}
+
+func newInotifyNotifier(fName string) (changeNotifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, err
+	}
+	n := &inotifyNotifier{fd: fd, fileName: fName, baseName: filepath.Base(fName)}
+	// Watch the directory so a file created in place of a rotated one is noticed.
+	_, err = syscall.InotifyAddWatch(fd, filepath.Dir(fName), syscall.IN_CREATE|syscall.IN_MOVED_TO)
+	if err != nil {
+		syscall.Close(fd)
+		return nil, err
+	}
+	// The file itself may not exist yet, in which case it is watched once created.
+	n.watchFile()
+	// A non blocking descriptor is handed to the runtime poller, which lets a
+	// blocked read be interrupted with a deadline.
+	n.file = os.NewFile(uintptr(fd), "inotify")
+	return n, nil
+}
+
+func (n *inotifyNotifier) watchFile() {
+	syscall.InotifyAddWatch(n.fd, n.fileName, syscall.IN_MODIFY|syscall.IN_MOVE_SELF|syscall.IN_DELETE_SELF)
+}
+
+func (n *inotifyNotifier) wait(ctx context.Context) error {
+	n.file.SetReadDeadline(time.Time{})
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		select {
+		case <-ctx.Done():
+			n.file.SetReadDeadline(time.Now())
+		case <-done:
+		}
+	}()
+
+	nr, err := n.file.Read(n.buf[:])
+	if err != nil {
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			// Left over from an earlier, cancelled wait.
+			return nil
+		}
+		return err
+	}
+
+	for offset := 0; offset+syscall.SizeofInotifyEvent <= nr; {
+		ev := (*syscall.InotifyEvent)(unsafe.Pointer(&n.buf[offset]))
+		nameStart := offset + syscall.SizeofInotifyEvent
+		offset = nameStart + int(ev.Len)
+		if ev.Mask&(syscall.IN_CREATE|syscall.IN_MOVED_TO) == 0 || offset > nr {
+			continue
+		}
+		name := n.buf[nameStart:offset]
+		for i, b := range name {
+			if b == 0 {
+				name = name[:i]
+				break
+			}
+		}
+		if string(name) == n.baseName {
+			n.watchFile()
+		}
+	}
+	return nil
+}
+
+func (n *inotifyNotifier) close() error {
+	return n.file.Close()
+}
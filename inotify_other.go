@@ -0,0 +1,9 @@
+//go:build !linux
+
+package monitor
+
+import "errors"
+
+func newInotifyNotifier(fName string) (changeNotifier, error) {
+	return nil, errors.New("inotify is only available on Linux")
+}
@@ -0,0 +1,198 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONFieldMapping says which keys of a JSON access log hold the fields LogStats
+// uses. Keys inside nested objects are written as a path joined with dots, such
+// as "request.host". Fields whose key is empty are not read. When a key holds
+// an array, such as a list of header values, its first element is used.
+type JSONFieldMapping struct {
+	Time string
+	// TimeFormat is "rfc3339", "epoch" for seconds or "epoch_ms" for
+	// milliseconds. When empty, strings are read as RFC 3339 and numbers as
+	// epoch seconds, or milliseconds when they are too large to be seconds.
+	TimeFormat string
+	Host       string
+	// Path is the request URI, either absolute or just the path and query.
+	Path   string
+	Status string
+	Bytes  string
+	// Duration is read as a Go duration string, such as "1.5ms", or as a
+	// number of DurationUnit, which defaults to a second.
+	Duration     string
+	DurationUnit time.Duration
+	Method       string
+	Client       string
+	Referer      string
+	UserAgent    string
+}
+
+// epochMillisThreshold is the smallest epoch timestamp read as milliseconds
+// when the format is guessed. As seconds it is in the year 5138.
+const epochMillisThreshold = 1e11
+
+// JSONParser parses access logs written as one JSON object per line. Top level
+// keys that are not in the mapping are kept in Extra.
+type JSONParser struct {
+	name    string
+	mapping JSONFieldMapping
+	fields  map[string]recordField
+}
+
+// NewJSONParser returns a parser reading the fields given by mapping.
+func NewJSONParser(name string, mapping JSONFieldMapping) (*JSONParser, error) {
+	p := &JSONParser{name: name, mapping: mapping, fields: make(map[string]recordField)}
+	if mapping.Path == "" {
+		return nil, errors.New("The JSON mapping " + name + " has no path key!")
+	}
+	if mapping.Time == "" {
+		return nil, errors.New("The JSON mapping " + name + " has no time key!")
+	}
+	switch mapping.TimeFormat {
+	case "":
+	case "rfc3339":
+		p.fields[mapping.Time] = fieldTimeISO8601
+	case "epoch":
+		p.fields[mapping.Time] = fieldTimeEpoch
+	case "epoch_ms":
+		p.fields[mapping.Time] = fieldTimeEpochMillis
+	default:
+		return nil, errors.New("Unknown JSON time format " + mapping.TimeFormat)
+	}
+	if p.mapping.DurationUnit == 0 {
+		p.mapping.DurationUnit = time.Second
+	}
+	p.fields[mapping.Path] = fieldURI
+	p.fields[mapping.Host] = fieldHost
+	p.fields[mapping.Status] = fieldStatus
+	p.fields[mapping.Bytes] = fieldBytes
+	p.fields[mapping.Method] = fieldMethod
+	p.fields[mapping.Client] = fieldClient
+	p.fields[mapping.Referer] = fieldReferer
+	p.fields[mapping.UserAgent] = fieldUserAgent
+	delete(p.fields, "")
+	return p, nil
+}
+
+// Name implements Parser.
+func (p *JSONParser) Name() string {
+	return "json:" + p.name
+}
+
+// Parse implements Parser.
+func (p *JSONParser) Parse(line string) (*AccessRecord, error) {
+	d := json.NewDecoder(strings.NewReader(line))
+	d.UseNumber()
+	var obj map[string]interface{}
+	if err := d.Decode(&obj); err != nil {
+		return nil, fmt.Errorf("%w: not a JSON object: %s", ErrFormatMismatch, err)
+	}
+
+	values := make(map[string]string)
+	for key, v := range obj {
+		if s, ok := jsonScalar(v); ok && !p.mapped(key) {
+			values[key] = s
+		}
+	}
+	for key := range p.fields {
+		if s, ok := jsonScalar(lookupJSON(obj, key)); ok {
+			values[key] = s
+		}
+	}
+
+	r := new(AccessRecord)
+	if err := fillFromVariables(r, values, p.fields); err != nil {
+		return nil, err
+	}
+	var err error
+	if p.mapping.Time != "" && p.mapping.TimeFormat == "" {
+		if v, ok := jsonScalar(lookupJSON(obj, p.mapping.Time)); ok {
+			if r.Time, err = guessTime(v); err != nil {
+				return nil, fmt.Errorf("%w %q in log line: %s", ErrInvalidValue, v, err)
+			}
+		}
+	}
+	if p.mapping.Duration != "" {
+		if v, ok := jsonScalar(lookupJSON(obj, p.mapping.Duration)); ok {
+			if r.Duration, err = p.duration(v); err != nil {
+				return nil, fmt.Errorf("%w %q in log line: %s", ErrInvalidValue, v, err)
+			}
+			r.HasDuration = true
+		}
+	}
+	return r, nil
+}
+
+// mapped reports whether key is one of the keys in the mapping.
+func (p *JSONParser) mapped(key string) bool {
+	_, ok := p.fields[key]
+	return ok || key == p.mapping.Time || key == p.mapping.Duration
+}
+
+// duration reads a duration value as a Go duration or a number of the
+// mapping's unit.
+func (p *JSONParser) duration(v string) (time.Duration, error) {
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.ParseDuration(v)
+	}
+	return time.Duration(n * float64(p.mapping.DurationUnit)), nil
+}
+
+// guessTime reads an RFC 3339 timestamp, or an epoch timestamp in seconds or
+// milliseconds.
+func guessTime(v string) (time.Time, error) {
+	n, err := strconv.ParseFloat(v, 64)
+	if err != nil {
+		return time.Parse(time.RFC3339Nano, v)
+	}
+	if math.Abs(n) >= epochMillisThreshold {
+		return time.UnixMicro(int64(n * 1000)), nil
+	}
+	return parseEpoch(v)
+}
+
+// lookupJSON returns the value at a dotted path in obj, or nil. Keys that
+// themselves contain dots are matched before nested objects. Arrays are
+// replaced by their first element.
+func lookupJSON(obj map[string]interface{}, path string) interface{} {
+	if v, ok := obj[path]; ok {
+		if a, ok := v.([]interface{}); ok && len(a) > 0 {
+			return a[0]
+		}
+		return v
+	}
+	for i := 0; i < len(path); i++ {
+		if path[i] != '.' {
+			continue
+		}
+		if nested, ok := obj[path[:i]].(map[string]interface{}); ok {
+			if v := lookupJSON(nested, path[i+1:]); v != nil {
+				return v
+			}
+		}
+	}
+	return nil
+}
+
+// jsonScalar formats a string, number or boolean value as a string. It returns
+// false for nulls, objects and arrays.
+func jsonScalar(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case json.Number:
+		return v.String(), true
+	case bool:
+		return strconv.FormatBool(v), true
+	}
+	return "", false
+}
@@ -0,0 +1,141 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+var testJSONMapping = JSONFieldMapping{
+	Time:     "ts",
+	Host:     "request.host",
+	Path:     "request.uri",
+	Status:   "status",
+	Bytes:    "size",
+	Duration: "duration",
+}
+
+func TestJSONParser(t *testing.T) {
+	p, err := NewJSONParser("app", testJSONMapping)
+	if err != nil {
+		t.Errorf("Failed to create the parser! %s", err)
+		t.FailNow()
+	}
+	r, err := p.Parse(`{"ts": "2026-10-16T08:00:00.250Z", "request": {"host": "my.site.com", "uri": "/pages/create?x=1"}, "status": 201, "size": 512, "duration": 0.125, "level": "info", "tags": ["a"]}`)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if !r.Time.Equal(time.Date(2026, 10, 16, 8, 0, 0, 250e6, time.UTC)) {
+		t.Errorf("Unexpected time %s", r.Time)
+	}
+	if r.Host != "my.site.com" || r.URL.Path != "/pages/create" || r.URL.RawQuery != "x=1" {
+		t.Errorf("Unexpected host %s or URL %s", r.Host, r.URL)
+	}
+	if r.Status != 201 || r.Bytes != 512 || r.Duration != 125*time.Millisecond {
+		t.Errorf("Unexpected status %d, bytes %d or duration %s", r.Status, r.Bytes, r.Duration)
+	}
+	if r.Extra["level"] != "info" || len(r.Extra) != 1 {
+		t.Errorf("Expected only the level in the extras but got %v", r.Extra)
+	}
+	if p.Name() != "json:app" {
+		t.Errorf("Unexpected name %s", p.Name())
+	}
+}
+
+func TestJSONParserTimestamps(t *testing.T) {
+	expected := time.Date(2026, 10, 16, 8, 0, 0, 500e6, time.UTC)
+	tests := []struct {
+		format string
+		value  string
+	}{
+		{"", `"2026-10-16T10:00:00.5+02:00"`},
+		{"", `1792137600.5`},
+		{"", `1792137600500`},
+		{"", `"1792137600500"`},
+		{"rfc3339", `"2026-10-16T08:00:00.5Z"`},
+		{"epoch", `"1792137600.5"`},
+		{"epoch_ms", `1792137600500`},
+	}
+	for _, test := range tests {
+		m := testJSONMapping
+		m.TimeFormat = test.format
+		p, err := NewJSONParser("app", m)
+		if err != nil {
+			t.Errorf("Failed to create the parser! %s", err)
+			t.FailNow()
+		}
+		r, err := p.Parse(`{"ts": ` + test.value + `, "request": {"uri": "http://my.site.com/"}}`)
+		if err != nil {
+			t.Errorf("Failed to parse %s as %q! %s", test.value, test.format, err)
+			continue
+		}
+		if !r.Time.Equal(expected) {
+			t.Errorf("Expected %s from %s as %q but got %s", expected, test.value, test.format, r.Time)
+		}
+	}
+}
+
+func TestJSONParserDurations(t *testing.T) {
+	m := testJSONMapping
+	m.DurationUnit = time.Millisecond
+	p, _ := NewJSONParser("app", m)
+	for value, expected := range map[string]time.Duration{
+		`15`:      15 * time.Millisecond,
+		`"2.5"`:   2500 * time.Microsecond,
+		`"1.5s"`:  1500 * time.Millisecond,
+		`"300us"`: 300 * time.Microsecond,
+	} {
+		r, err := p.Parse(`{"ts": 1792137600, "duration": ` + value + `, "request": {"uri": "http://my.site.com/"}}`)
+		if err != nil {
+			t.Errorf("Failed to parse the duration %s! %s", value, err)
+			continue
+		}
+		if r.Duration != expected {
+			t.Errorf("Expected %s from %s but got %s", expected, value, r.Duration)
+		}
+	}
+}
+
+func TestJSONParserErrors(t *testing.T) {
+	if _, err := NewJSONParser("bad", JSONFieldMapping{Time: "ts"}); err == nil {
+		t.Errorf("Expected an error for a mapping without a path!")
+	}
+	if _, err := NewJSONParser("bad", JSONFieldMapping{Path: "uri"}); err == nil {
+		t.Errorf("Expected an error for a mapping without a time!")
+	}
+	if _, err := NewJSONParser("bad", JSONFieldMapping{Time: "ts", Path: "uri", TimeFormat: "unix"}); err == nil {
+		t.Errorf("Expected an error for an unknown time format!")
+	}
+	p, _ := NewJSONParser("app", testJSONMapping)
+	for _, line := range []string{
+		`not json`,
+		`{"ts": "yesterday", "request": {"uri": "/"}}`,
+		`{"ts": 1792137600, "status": "ok", "request": {"uri": "/"}}`,
+		`{"ts": 1792137600, "duration": "slow", "request": {"uri": "/"}}`,
+		`{"ts": 1792137600, "request": {}}`,
+	} {
+		if _, err := p.Parse(line); err == nil {
+			t.Errorf("Expected an error for %s", line)
+		}
+	}
+}
+
+func TestLogStatsJSONParser(t *testing.T) {
+	p, _ := NewJSONParser("app", testJSONMapping)
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(p)
+	for _, line := range []string{
+		`{"ts": 1792137600, "request": {"uri": "http://my.site.com/pages/a"}, "status": 200, "duration": 0.004}`,
+		`{"ts": 1792137601, "request": {"uri": "http://my.site.com/pages/b"}, "status": 200, "duration": 0.002}`,
+	} {
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if stats.TotalSiteRequests() != 2 {
+		t.Errorf("Expected 2 requests but got %d", stats.TotalSiteRequests())
+	}
+	if d := stats.PopularSections()[0].AverageDuration(); d != 3*time.Millisecond {
+		t.Errorf("Expected an average response time of 3ms but got %s", d)
+	}
+}
@@ -0,0 +1,135 @@
+package monitor
+
+import (
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Checkpoint records which file a LogReader was reading and how far it got, so
+// that a restarted reader can carry on from the same place.
+type Checkpoint struct {
+	FileName string `json:"file_name"`
+	Device   uint64 `json:"device"`
+	Inode    uint64 `json:"inode"`
+	Offset   int64  `json:"offset"`
+}
+
+// SaveCheckpoint writes c to path. The checkpoint is written to a temporary file
+// that is then renamed over path, so a crash never leaves a half written file.
+func SaveCheckpoint(path string, c *Checkpoint) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp")
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(data)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// LoadCheckpoint reads a checkpoint written by SaveCheckpoint.
+func LoadCheckpoint(path string) (*Checkpoint, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	c := new(Checkpoint)
+	if err := json.Unmarshal(data, c); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// NewCheckpointedLogReader constructs a log reader that saves its position to
+// checkpointFile at most once every interval, and when it is closed. If
+// checkpointFile already holds the position of the file at fName, reading
+// resumes there. If fName has been replaced since the checkpoint was saved, the
+// new file is read from the beginning. Without a checkpoint the file is read
+// from the beginning, or from its current end when startAtEnd is set.
+func NewCheckpointedLogReader(fName string, checkpointFile string, interval time.Duration, startAtEnd bool) (*LogReader, error) {
+	r := NewLogReader(fName)
+	r.checkpointFile = checkpointFile
+	r.checkpointInterval = interval
+
+	c, err := LoadCheckpoint(checkpointFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err := r.open(); err != nil {
+		if os.IsNotExist(err) {
+			// Nothing to resume, the file is read from the start once it exists.
+			return r, nil
+		}
+		return nil, err
+	}
+	info, err := r.file.Stat()
+	if err != nil {
+		r.Close()
+		return nil, err
+	}
+
+	switch {
+	case c == nil:
+		if startAtEnd {
+			r.lastSize = info.Size()
+		}
+	case c.Device != r.identity.Device || c.Inode != r.identity.Inode:
+		log.Println("Log file ", fName, " was replaced since the last checkpoint, starting from the beginning.")
+	case c.Offset > info.Size():
+		log.Println("Log file ", fName, " was truncated since the last checkpoint, starting from the beginning.")
+	default:
+		r.lastSize = c.Offset
+	}
+	r.lastCheckpoint = time.Now()
+	return r, nil
+}
+
+// Checkpoint returns the reader's current position. A partial line that has
+// been held back is not counted, nor are the records of a container line the
+// decoder is still reassembling, so they are read again in full after a restart.
+func (l *LogReader) Checkpoint() *Checkpoint {
+	offset := l.lastSize - l.pending.size
+	if l.decoder != nil && l.decoded >= 0 {
+		offset = l.decoded
+	}
+	return &Checkpoint{
+		FileName: l.fileName,
+		Device:   l.identity.Device,
+		Inode:    l.identity.Inode,
+		Offset:   offset,
+	}
+}
+
+// SaveCheckpoint writes the reader's current position to its checkpoint file.
+func (l *LogReader) SaveCheckpoint() error {
+	if l.checkpointFile == "" || l.file == nil {
+		return nil
+	}
+	l.lastCheckpoint = time.Now()
+	return SaveCheckpoint(l.checkpointFile, l.Checkpoint())
+}
+
+// maybeSaveCheckpoint saves the position once the checkpoint interval has passed.
+func (l *LogReader) maybeSaveCheckpoint() error {
+	if l.checkpointFile == "" || time.Since(l.lastCheckpoint) < l.checkpointInterval {
+		return nil
+	}
+	return l.SaveCheckpoint()
+}
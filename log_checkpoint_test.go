@@ -0,0 +1,156 @@
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestSaveLoadCheckpoint(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reader.checkpoint")
+	c := &Checkpoint{FileName: "access.log", Device: 1, Inode: 2, Offset: 42}
+	if err := SaveCheckpoint(path, c); err != nil {
+		t.Errorf("Failed to save the checkpoint! %s", err)
+		t.FailNow()
+	}
+	loaded, err := LoadCheckpoint(path)
+	if err != nil {
+		t.Errorf("Failed to load the checkpoint! %s", err)
+		t.FailNow()
+	}
+	if *loaded != *c {
+		t.Errorf("Expected %v but got %v instead.", *c, *loaded)
+	}
+}
+
+func TestCheckpointedLogReaderResumes(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	checkpoint := filepath.Join(dir, "reader.checkpoint")
+	writeLines(t, fName, "one", "two")
+
+	r, err := NewCheckpointedLogReader(fName, checkpoint, 0, false)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	entries, _ := r.GetNewLogEntries()
+	if len(entries) != 2 {
+		t.Errorf("Expected 2 entries but got %d", len(entries))
+	}
+	r.Close()
+
+	writeLines(t, fName, "three")
+	r, err = NewCheckpointedLogReader(fName, checkpoint, 0, false)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	defer r.Close()
+	entries, _ = r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "three" {
+		t.Errorf("Expected to resume with [three] but got %v", entries)
+	}
+}
+
+func TestCheckpointedLogReaderStartAtEnd(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	writeLines(t, fName, "one", "two")
+
+	r, err := NewCheckpointedLogReader(fName, filepath.Join(dir, "reader.checkpoint"), 0, true)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	defer r.Close()
+	entries, _ := r.GetNewLogEntries()
+	if entries != nil {
+		t.Errorf("Expected to start at the end of the file but got %v", entries)
+	}
+	writeLines(t, fName, "three")
+	entries, _ = r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "three" {
+		t.Errorf("Expected [three] but got %v", entries)
+	}
+}
+
+func TestCheckpointedLogReaderReplacedFile(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	checkpoint := filepath.Join(dir, "reader.checkpoint")
+	writeLines(t, fName, "one", "two")
+
+	r, _ := NewCheckpointedLogReader(fName, checkpoint, 0, false)
+	r.GetNewLogEntries()
+	r.Close()
+
+	// Rotated while the reader was not running.
+	os.Rename(fName, fName+".1")
+	writeLines(t, fName, "three", "four", "five")
+
+	r, err := NewCheckpointedLogReader(fName, checkpoint, 0, true)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	defer r.Close()
+	entries, _ := r.GetNewLogEntries()
+	if len(entries) != 3 || entries[0] != "three" {
+		t.Errorf("Expected the new file from the beginning but got %v", entries)
+	}
+}
+
+func TestCheckpointInterval(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	checkpoint := filepath.Join(dir, "reader.checkpoint")
+	writeLines(t, fName, "one")
+
+	r, _ := NewCheckpointedLogReader(fName, checkpoint, 1<<62, false)
+	r.GetNewLogEntries()
+	if _, err := os.Stat(checkpoint); !os.IsNotExist(err) {
+		t.Errorf("The checkpoint should not be written before the interval has passed!")
+	}
+	r.Close()
+	c, err := LoadCheckpoint(checkpoint)
+	if err != nil {
+		t.Errorf("The checkpoint should be written on close! %s", err)
+		t.FailNow()
+	}
+	if c.Offset != int64(len("one\n")) {
+		t.Errorf("Expected an offset of %d but got %d instead.", len("one\n"), c.Offset)
+	}
+}
+
+func TestCheckpointPartialContainerLine(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "container.log")
+	checkpoint := filepath.Join(dir, "reader.checkpoint")
+	writeLines(t, fName, `2026-10-16T08:00:00Z stdout F one`, `2026-10-16T08:00:01Z stdout P tw`)
+
+	r, err := NewCheckpointedLogReader(fName, checkpoint, 0, false)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	r.SetDecoder(new(CRIDecoder))
+	entries, _ := r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "one" {
+		t.Errorf("Expected [one] but got %v", entries)
+	}
+	r.Close()
+
+	writeLines(t, fName, `2026-10-16T08:00:01Z stdout F o`)
+	r, err = NewCheckpointedLogReader(fName, checkpoint, 0, false)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	defer r.Close()
+	r.SetDecoder(new(CRIDecoder))
+	entries, _ = r.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "two" {
+		t.Errorf("Expected to resume with [two] but got %v", entries)
+	}
+}
@@ -0,0 +1,223 @@
+package monitor
+
+import (
+	"bufio"
+	"bytes"
+	"compress/bzip2"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+var (
+	gzipMagic  = []byte{0x1f, 0x8b}
+	bzip2Magic = []byte("BZh")
+	zstdMagic  = []byte{0x28, 0xb5, 0x2f, 0xfd}
+)
+
+// OpenLogFile opens fName for reading. If the file starts with the magic number
+// of a gzip, bzip2 or zstd stream it is decompressed as it is read, whatever
+// its name.
+func OpenLogFile(fName string) (io.ReadCloser, error) {
+	f, err := os.Open(fName)
+	if err != nil {
+		return nil, err
+	}
+	r, err := decompress(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// compressedFile closes both the decompressor and the file underneath it.
+type compressedFile struct {
+	io.Reader
+	closeReader func()
+	file        *os.File
+}
+
+func (c *compressedFile) Close() error {
+	if c.closeReader != nil {
+		c.closeReader()
+	}
+	return c.file.Close()
+}
+
+func decompress(f *os.File) (io.ReadCloser, error) {
+	br := bufio.NewReader(f)
+	magic, err := br.Peek(4)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic, gzipMagic):
+		gz, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedFile{Reader: gz, closeReader: func() { gz.Close() }, file: f}, nil
+	case bytes.HasPrefix(magic, bzip2Magic):
+		return &compressedFile{Reader: bzip2.NewReader(br), file: f}, nil
+	case bytes.HasPrefix(magic, zstdMagic):
+		zr, err := zstd.NewReader(br)
+		if err != nil {
+			return nil, err
+		}
+		return &compressedFile{Reader: zr, closeReader: zr.Close, file: f}, nil
+	}
+	return &compressedFile{Reader: br, file: f}, nil
+}
+
+var rotatedSuffix = regexp.MustCompile(`^\.(\d+)(\.gz|\.bz2|\.zst)?$`)
+
+// RotatedLogFiles returns the rotated copies of fName, such as fName.1 and
+// fName.2.gz, ordered from oldest to newest.
+func RotatedLogFiles(fName string) ([]string, error) {
+	matches, err := filepath.Glob(fName + ".*")
+	if err != nil {
+		return nil, err
+	}
+	generation := make(map[string]int)
+	var files []string
+	for _, m := range matches {
+		res := rotatedSuffix.FindStringSubmatch(strings.TrimPrefix(m, fName))
+		if res == nil {
+			continue
+		}
+		n, _ := strconv.Atoi(res[1])
+		generation[m] = n
+		files = append(files, m)
+	}
+	sort.Slice(files, func(i, j int) bool { return generation[files[i]] > generation[files[j]] })
+	return files, nil
+}
+
+// BackfillLogReader reads every rotated copy of a log file, oldest first, and
+// then carries on tailing the live file like a LogReader. The rotated copies are
+// found when the reader is constructed.
+type BackfillLogReader struct {
+	archives []string
+	current  io.ReadCloser
+	name     string // Of the current archive
+	offset   int64  // Decompressed bytes read from the current archive
+	reader   *bufio.Reader
+	pending  lineBuffer
+	maxBatch int
+	live     *LogReader
+}
+
+// NewBackfillLogReader constructs a reader for fName and its rotated copies.
+func NewBackfillLogReader(fName string) (*BackfillLogReader, error) {
+	archives, err := RotatedLogFiles(fName)
+	if err != nil {
+		return nil, err
+	}
+	b := new(BackfillLogReader)
+	b.archives = archives
+	b.live = NewLogReader(fName)
+	b.pending.maxLength = DefaultMaxLineLength
+	b.maxBatch = DefaultMaxBatchSize
+	return b, nil
+}
+
+// SetMaxBatchSize sets the most lines GetNewLogEntries returns at once, from
+// the archives and the live file alike. Zero means no limit.
+func (b *BackfillLogReader) SetMaxBatchSize(n int) {
+	b.maxBatch = n
+	b.live.SetMaxBatchSize(n)
+}
+
+// SetMaxLineLength sets the longest line, in bytes, the reader returns, as
+// LogReader.SetMaxLineLength does.
+func (b *BackfillLogReader) SetMaxLineLength(n int, truncate bool) {
+	b.pending.maxLength = n
+	b.pending.truncate = truncate
+	b.live.SetMaxLineLength(n, truncate)
+}
+
+// OversizedLines returns how many lines, archived or live, were longer than
+// the maximum line length.
+func (b *BackfillLogReader) OversizedLines() int {
+	return b.pending.oversized + b.live.OversizedLines()
+}
+
+// GetNewLogEntries returns the next lines of the oldest archive not yet read,
+// at most DefaultMaxBatchSize at a time unless SetMaxBatchSize says otherwise.
+// Lines longer than DefaultMaxLineLength are skipped. Once every archive has
+// been read it returns the new lines of the live file.
+func (b *BackfillLogReader) GetNewLogEntries() ([]string, error) {
+	entries, err := b.GetNewEntries()
+	return entryTexts(entries), err
+}
+
+// GetNewEntries works like GetNewLogEntries, returning each line along with
+// the file it was read from and its offset there. The offsets of lines from
+// compressed archives are offsets into the decompressed text.
+func (b *BackfillLogReader) GetNewEntries() ([]LogEntry, error) {
+	for b.current != nil || len(b.archives) > 0 {
+		if b.current == nil {
+			r, err := OpenLogFile(b.archives[0])
+			if err != nil {
+				return nil, err
+			}
+			b.name = b.archives[0]
+			b.archives = b.archives[1:]
+			b.current = r
+			b.offset = 0
+			b.reader = bufio.NewReader(r)
+		}
+
+		var entries []LogEntry
+		for b.maxBatch == 0 || len(entries) < b.maxBatch {
+			chunk, err := b.reader.ReadSlice('\n')
+			b.offset += int64(len(chunk))
+			b.pending.add(chunk)
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err == nil || b.pending.size > 0 {
+				// The last line of an archive may have no newline.
+				start := b.offset - b.pending.size
+				if line, ok := b.pending.line(); ok {
+					entries = append(entries, LogEntry{Source: b.name, Text: line, Offset: start})
+				}
+			}
+			if err != nil {
+				b.current.Close()
+				b.current = nil
+				if err != io.EOF {
+					return entries, err
+				}
+				break
+			}
+		}
+		if len(entries) > 0 {
+			return entries, nil
+		}
+	}
+	return b.live.GetNewEntries()
+}
+
+// Backfilling reports whether there are archived lines left to read.
+func (b *BackfillLogReader) Backfilling() bool {
+	return b.current != nil || len(b.archives) > 0
+}
+
+// Close closes the archive being read and the live file.
+func (b *BackfillLogReader) Close() error {
+	if b.current != nil {
+		b.current.Close()
+		b.current = nil
+	}
+	return b.live.Close()
+}
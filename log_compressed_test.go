@@ -0,0 +1,173 @@
+package monitor
+
+import (
+	"compress/gzip"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// printf 'b1\nb2\n' | bzip2
+const bzip2Lines = "425a6839314159265359365d16290000024900001030001000200030cd3418c80c67177245385090365d1629"
+
+func writeGzip(t *testing.T, fName string, data string) {
+	f, err := os.Create(fName)
+	if err != nil {
+		t.Errorf("Could not create %s! %s", fName, err)
+		t.FailNow()
+	}
+	defer f.Close()
+	w := gzip.NewWriter(f)
+	w.Write([]byte(data))
+	w.Close()
+}
+
+func writeZstd(t *testing.T, fName string, data string) {
+	f, err := os.Create(fName)
+	if err != nil {
+		t.Errorf("Could not create %s! %s", fName, err)
+		t.FailNow()
+	}
+	defer f.Close()
+	w, _ := zstd.NewWriter(f)
+	w.Write([]byte(data))
+	w.Close()
+}
+
+func TestOpenLogFileCompressed(t *testing.T) {
+	dir := t.TempDir()
+	gz := filepath.Join(dir, "access.log.gz")
+	writeGzip(t, gz, "g1\ng2\n")
+	zst := filepath.Join(dir, "access.log.zst")
+	writeZstd(t, zst, "z1\nz2\n")
+	bz := filepath.Join(dir, "access.log.bz2")
+	data, _ := hex.DecodeString(bzip2Lines)
+	os.WriteFile(bz, data, 0644)
+	// The name does not matter, only the contents.
+	plain := filepath.Join(dir, "access.log.gz.txt")
+	os.WriteFile(plain, []byte("p1\np2\n"), 0644)
+
+	expected := map[string]string{gz: "g1\ng2\n", zst: "z1\nz2\n", bz: "b1\nb2\n", plain: "p1\np2\n"}
+	for fName, contents := range expected {
+		r, err := OpenLogFile(fName)
+		if err != nil {
+			t.Errorf("Failed to open %s! %s", fName, err)
+			continue
+		}
+		data, err := io.ReadAll(r)
+		r.Close()
+		if err != nil {
+			t.Errorf("Failed to read %s! %s", fName, err)
+		}
+		if string(data) != contents {
+			t.Errorf("Expected %q from %s but got %q instead.", contents, fName, data)
+		}
+	}
+}
+
+func TestRotatedLogFiles(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	for _, f := range []string{"access.log", "access.log.1", "access.log.2.gz", "access.log.10.zst", "access.log.old", "access.log.3.bak"} {
+		os.WriteFile(filepath.Join(dir, f), nil, 0644)
+	}
+
+	files, err := RotatedLogFiles(fName)
+	if err != nil {
+		t.Errorf("Failed to find the rotated files! %s", err)
+		t.FailNow()
+	}
+	expected := []string{fName + ".10.zst", fName + ".2.gz", fName + ".1"}
+	if len(files) != len(expected) {
+		t.Errorf("Expected %v but got %v instead.", expected, files)
+		t.FailNow()
+	}
+	for i := range expected {
+		if expected[i] != files[i] {
+			t.Errorf("Expected %s but got %s instead.", expected[i], files[i])
+		}
+	}
+}
+
+func TestBackfillLogReader(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	writeZstd(t, fName+".3.zst", "one\n")
+	writeGzip(t, fName+".2.gz", "two\nthree\n")
+	writeLines(t, fName+".1", "four")
+	writeLines(t, fName, "five")
+
+	b, err := NewBackfillLogReader(fName)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	defer b.Close()
+
+	var all []string
+	for b.Backfilling() {
+		entries, err := b.GetNewLogEntries()
+		if err != nil {
+			t.Errorf("Failed to backfill! %s", err)
+			t.FailNow()
+		}
+		all = append(all, entries...)
+	}
+	entries, _ := b.GetNewLogEntries()
+	all = append(all, entries...)
+
+	expected := []string{"one", "two", "three", "four", "five"}
+	if len(all) != len(expected) {
+		t.Errorf("Expected %v but got %v instead.", expected, all)
+		t.FailNow()
+	}
+	for i := range expected {
+		if expected[i] != all[i] {
+			t.Errorf("Expected %s but got %s instead.", expected[i], all[i])
+		}
+	}
+
+	writeLines(t, fName, "six")
+	entries, _ = b.GetNewLogEntries()
+	if len(entries) != 1 || entries[0] != "six" {
+		t.Errorf("Expected to tail the live file but got %v", entries)
+	}
+}
+
+func TestBackfillLogReaderLimits(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	writeGzip(t, fName+".1.gz", "one\nmuch too long\ntwo\nthree\n")
+	writeLines(t, fName, "four", "also too long")
+
+	b, err := NewBackfillLogReader(fName)
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	defer b.Close()
+	b.SetMaxLineLength(5, true)
+	b.SetMaxBatchSize(2)
+
+	var batches [][]string
+	for i := 0; i < 4; i++ {
+		entries, err := b.GetNewLogEntries()
+		if err != nil {
+			t.Errorf("Failed to read! %s", err)
+			t.FailNow()
+		}
+		batches = append(batches, entries)
+	}
+	expected := "[[one much ] [two three] [four also ] []]"
+	if actual := fmt.Sprint(batches); actual != expected {
+		t.Errorf("Expected %s but got %s instead.", expected, actual)
+	}
+	if b.OversizedLines() != 2 {
+		t.Errorf("Expected 2 oversized lines but got %d", b.OversizedLines())
+	}
+}
@@ -0,0 +1,138 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"path/filepath"
+	"sort"
+	"time"
+)
+
+// LogEntry is a single line read from a log file along with the path of the
+// file it came from and the offset of its first byte in that file. The offset
+// is -1 when it is not known.
+type LogEntry struct {
+	Source string
+	Text   string
+	Offset int64
+}
+
+// MultiLogReader reads every file matching a set of glob patterns, keeping a
+// separate LogReader, and so a separate offset, for each file. Patterns are
+// matched again on every read so files created later are picked up too. Patterns
+// should not match the names that rotated files are moved to, or those files
+// will be read again from the beginning.
+type MultiLogReader struct {
+	patterns     []string
+	readers      map[string]*LogReader
+	pollInterval time.Duration
+}
+
+// NewMultiLogReader constructs a reader for all files matching patterns. An
+// error is returned if any of the patterns is malformed.
+func NewMultiLogReader(pollInterval time.Duration, patterns ...string) (*MultiLogReader, error) {
+	for _, p := range patterns {
+		if _, err := filepath.Match(p, ""); err != nil {
+			return nil, err
+		}
+	}
+	m := new(MultiLogReader)
+	m.patterns = patterns
+	m.readers = make(map[string]*LogReader)
+	m.pollInterval = pollInterval
+	return m, nil
+}
+
+// Files returns the paths of the files currently being read, sorted by name.
+func (m *MultiLogReader) Files() []string {
+	var files []string
+	for f := range m.readers {
+		files = append(files, f)
+	}
+	sort.Strings(files)
+	return files
+}
+
+// GetNewLogEntries returns the lines appended to every matching file since the
+// last call. Lines from the same file keep their order. A file that can not be
+// read does not stop the others from being read; the first error is returned
+// along with the entries that were read.
+func (m *MultiLogReader) GetNewLogEntries() ([]LogEntry, error) {
+	matched := make(map[string]bool)
+	for _, p := range m.patterns {
+		matches, _ := filepath.Glob(p)
+		for _, f := range matches {
+			matched[f] = true
+			if _, ok := m.readers[f]; !ok {
+				log.Println("Started reading ", f)
+				m.readers[f] = NewLogReader(f)
+			}
+		}
+	}
+
+	var entries []LogEntry
+	var firstErr error
+	for _, f := range m.Files() {
+		r := m.readers[f]
+		lines, err := r.GetNewEntries()
+		entries = append(entries, lines...)
+		if !matched[f] && len(lines) == 0 {
+			// Removed and fully read, it is picked up again if it comes back.
+			log.Println("Stopped reading ", f)
+			r.Close()
+			delete(m.readers, f)
+			continue
+		}
+		if err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return entries, firstErr
+}
+
+// Stream works like LogReader.Stream, checking all the files every poll
+// interval and sending each new line tagged with its source.
+func (m *MultiLogReader) Stream(ctx context.Context, bufferSize int) (<-chan LogEntry, <-chan error) {
+	entries := make(chan LogEntry, bufferSize)
+	errs := make(chan error, 1)
+	poll := &pollNotifier{interval: m.pollInterval}
+
+	go func() {
+		defer close(errs)
+		defer close(entries)
+		for {
+			batch, err := m.GetNewLogEntries()
+			for _, e := range batch {
+				select {
+				case entries <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if len(batch) == 0 && poll.wait(ctx) != nil {
+				return
+			}
+		}
+	}()
+
+	return entries, errs
+}
+
+// Close closes every file being read.
+func (m *MultiLogReader) Close() error {
+	var err error
+	for f, r := range m.readers {
+		if cerr := r.Close(); cerr != nil {
+			err = cerr
+		}
+		delete(m.readers, f)
+	}
+	return err
+}
@@ -0,0 +1,105 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMultiLogReader(t *testing.T) {
+	dir := t.TempDir()
+	first := filepath.Join(dir, "a.access.log")
+	second := filepath.Join(dir, "b.access.log")
+	writeLines(t, first, "a1", "a2")
+	writeLines(t, filepath.Join(dir, "error.log"), "ignored")
+
+	m, err := NewMultiLogReader(time.Millisecond, filepath.Join(dir, "*.access.log"))
+	if err != nil {
+		t.Errorf("Failed to create the reader! %s", err)
+		t.FailNow()
+	}
+	defer m.Close()
+
+	entries, err := m.GetNewLogEntries()
+	if err != nil || len(entries) != 2 {
+		t.Errorf("Expected 2 entries but got %v (%v)", entries, err)
+		t.FailNow()
+	}
+	if entries[0].Source != first || entries[0].Text != "a1" {
+		t.Errorf("Unexpected first entry %v", entries[0])
+	}
+
+	// A file created after the reader started is picked up as well.
+	writeLines(t, second, "b1")
+	writeLines(t, first, "a3")
+	entries, _ = m.GetNewLogEntries()
+	expected := []LogEntry{{first, "a3", 6}, {second, "b1", 0}}
+	if len(entries) != len(expected) {
+		t.Errorf("Expected %v but got %v instead.", expected, entries)
+		t.FailNow()
+	}
+	for i := range expected {
+		if expected[i] != entries[i] {
+			t.Errorf("Expected %v but got %v instead.", expected[i], entries[i])
+		}
+	}
+
+	if len(m.Files()) != 2 {
+		t.Errorf("Expected 2 files to be read but got %v", m.Files())
+	}
+	writeLines(t, second, "b2")
+	os.Remove(second)
+	entries, _ = m.GetNewLogEntries()
+	if len(entries) != 1 || entries[0].Text != "b2" {
+		t.Errorf("Expected a removed file to be read to the end but got %v", entries)
+	}
+	m.GetNewLogEntries()
+	if len(m.Files()) != 1 {
+		t.Errorf("Expected the removed file to be dropped but got %v", m.Files())
+	}
+}
+
+func TestMultiLogReaderBadPattern(t *testing.T) {
+	if _, err := NewMultiLogReader(time.Second, "[access.log"); err == nil {
+		t.Errorf("Expected an error for a malformed pattern!")
+	}
+}
+
+func TestMultiLogReaderStream(t *testing.T) {
+	dir := t.TempDir()
+	writeLines(t, filepath.Join(dir, "a.log"),
+		`127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "POST http://my.site.com/pages/create HTTP/1.0" 200 2326`)
+	writeLines(t, filepath.Join(dir, "b.log"),
+		`127.0.0.1 user-identifier frank [10/Oct/2000:13:55:37 -0700] "POST http://my.site.com/pets/create HTTP/1.0" 200 2326`)
+
+	m, _ := NewMultiLogReader(10*time.Millisecond, filepath.Join(dir, "*.log"))
+	defer m.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	entries, errs := m.Stream(ctx, 1)
+	defer func() {
+		// Wait for the stream to stop before the reader is closed.
+		cancel()
+		for range entries {
+		}
+		for range errs {
+		}
+	}()
+
+	stats := NewLogStatsDefault("my.site.com")
+	for i := 0; i < 2; i++ {
+		select {
+		case e := <-entries:
+			if err := stats.ProcessEntry(&e.Text); err != nil {
+				t.Errorf("Failed to process log entry! %s", err)
+			}
+		case <-time.After(5 * time.Second):
+			t.Errorf("Timed out waiting for entries")
+			t.FailNow()
+		}
+	}
+	if stats.UniqueSiteVisits() != 2 {
+		t.Errorf("Expected both files to be aggregated but got %d sections", stats.UniqueSiteVisits())
+	}
+}
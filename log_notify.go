@@ -0,0 +1,76 @@
+package monitor
+
+import (
+	"context"
+	"log"
+	"os"
+	"time"
+)
+
+// DefaultPollInterval is how often a LogReader checks its file for changes when
+// it can not be notified of them.
+const DefaultPollInterval = time.Second
+
+// changeNotifier blocks until the file being read might have changed.
+type changeNotifier interface {
+	wait(ctx context.Context) error
+	close() error
+}
+
+// pollNotifier wakes up after a fixed interval whether or not the file changed.
+type pollNotifier struct {
+	interval time.Duration
+}
+
+func (p *pollNotifier) wait(ctx context.Context) error {
+	t := time.NewTimer(p.interval)
+	defer t.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-t.C:
+		return nil
+	}
+}
+
+func (p *pollNotifier) close() error {
+	return nil
+}
+
+// NewNotifyingLogReader constructs a log reader whose WaitForNewLogEntries blocks
+// on inotify events for the file and its directory. If inotify is unavailable the
+// reader falls back to checking the file every pollInterval.
+func NewNotifyingLogReader(fName string, pollInterval time.Duration) *LogReader {
+	r := NewLogReader(fName)
+	n, err := newInotifyNotifier(fName)
+	if err != nil {
+		log.Println("Falling back to polling ", fName, ": ", err)
+		r.notifier = &pollNotifier{interval: pollInterval}
+	} else {
+		r.notifier = n
+	}
+	return r
+}
+
+// WaitForNewLogEntries blocks until new entries have been written to the file
+// and returns them, or until ctx is done. A file that does not exist yet is
+// waited for rather than reported as an error.
+func (l *LogReader) WaitForNewLogEntries(ctx context.Context) ([]string, error) {
+	entries, err := l.waitForNewEntries(ctx)
+	return entryTexts(entries), err
+}
+
+func (l *LogReader) waitForNewEntries(ctx context.Context) ([]LogEntry, error) {
+	if l.notifier == nil {
+		l.notifier = &pollNotifier{interval: DefaultPollInterval}
+	}
+	for {
+		entries, err := l.GetNewEntries()
+		if len(entries) > 0 || (err != nil && !os.IsNotExist(err)) {
+			return entries, err
+		}
+		if err := l.notifier.wait(ctx); err != nil {
+			return nil, err
+		}
+	}
+}
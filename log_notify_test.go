@@ -0,0 +1,118 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestWaitForNewLogEntries(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one")
+
+	r := NewNotifyingLogReader(fName, 10*time.Millisecond)
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	entries, err := r.WaitForNewLogEntries(ctx)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected the existing entry but got %v (%v)", entries, err)
+		t.FailNow()
+	}
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		appendLines(fName, "two")
+	}()
+	entries, err = r.WaitForNewLogEntries(ctx)
+	if err != nil {
+		t.Errorf("There was an error waiting for entries! %s", err)
+		t.FailNow()
+	}
+	if len(entries) != 1 || entries[0] != "two" {
+		t.Errorf("Expected [two] but got %v instead.", entries)
+	}
+}
+
+func TestWaitForNewLogEntriesRotation(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one")
+
+	r := NewNotifyingLogReader(fName, 10*time.Millisecond)
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	r.WaitForNewLogEntries(ctx)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		os.Rename(fName, fName+".1")
+		appendLines(fName, "two")
+	}()
+	entries, err := r.WaitForNewLogEntries(ctx)
+	if err != nil {
+		t.Errorf("There was an error waiting for entries! %s", err)
+		t.FailNow()
+	}
+	if len(entries) != 1 || entries[0] != "two" {
+		t.Errorf("Expected [two] but got %v instead.", entries)
+	}
+}
+
+func TestWaitForNewLogEntriesMissingFile(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+
+	r := NewNotifyingLogReader(fName, 10*time.Millisecond)
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		appendLines(fName, "one")
+	}()
+	entries, err := r.WaitForNewLogEntries(ctx)
+	if err != nil || len(entries) != 1 {
+		t.Errorf("Expected to wait for the file to be created but got %v (%v)", entries, err)
+	}
+}
+
+func TestWaitForNewLogEntriesCancel(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one")
+
+	r := NewNotifyingLogReader(fName, 10*time.Millisecond)
+	defer r.Close()
+	r.GetNewLogEntries()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	_, err := r.WaitForNewLogEntries(ctx)
+	if err != context.DeadlineExceeded {
+		t.Errorf("Expected the wait to be cancelled but got %v", err)
+	}
+}
+
+func TestWaitForNewLogEntriesPolling(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one")
+
+	r := NewLogReader(fName)
+	r.notifier = &pollNotifier{interval: 10 * time.Millisecond}
+	defer r.Close()
+	r.GetNewLogEntries()
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		appendLines(fName, "two")
+	}()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	entries, err := r.WaitForNewLogEntries(ctx)
+	if err != nil || len(entries) != 1 || entries[0] != "two" {
+		t.Errorf("Expected [two] but got %v (%v)", entries, err)
+	}
+}
@@ -0,0 +1,251 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogSource is anything that log lines can be read from. LogReader,
+// BackfillLogReader and ReaderSource all implement it.
+type LogSource interface {
+	// GetNewLogEntries returns the lines that arrived since the last call without
+	// waiting for more. Once a source has ended and all of its lines have been
+	// returned, it returns io.EOF.
+	GetNewLogEntries() ([]string, error)
+	Close() error
+}
+
+// EntrySource is a LogSource that can also say where each of its lines came
+// from. LogReader, BackfillLogReader and ReaderSource all implement it.
+type EntrySource interface {
+	LogSource
+	// GetNewEntries works like GetNewLogEntries, returning each line along
+	// with its source and offset.
+	GetNewEntries() ([]LogEntry, error)
+}
+
+// readerSourceBuffer is how many lines a ReaderSource reads ahead of its consumer.
+const readerSourceBuffer = 1024
+
+// ReaderSource reads lines from an io.Reader such as stdin, a pipe or an in
+// memory buffer. The reader is read in its own goroutine, which waits whenever
+// readerSourceBuffer lines are waiting to be collected. Lines longer than
+// DefaultMaxLineLength are skipped unless SetMaxLineLength says otherwise.
+type ReaderSource struct {
+	name   string
+	lines  chan LogEntry
+	done   chan struct{}
+	closer io.Closer
+	once   sync.Once
+
+	mu       sync.Mutex
+	err      error      // Why reading stopped, valid once lines is closed
+	pending  lineBuffer // Shared with the reading goroutine
+	maxBatch int
+}
+
+// NewReaderSource constructs a source reading lines from r. If r is also an
+// io.Closer it is closed when the source is.
+func NewReaderSource(r io.Reader) *ReaderSource {
+	return newReaderSource(r, "")
+}
+
+func newReaderSource(r io.Reader, name string) *ReaderSource {
+	s := new(ReaderSource)
+	s.name = name
+	s.lines = make(chan LogEntry, readerSourceBuffer)
+	s.done = make(chan struct{})
+	s.closer, _ = r.(io.Closer)
+	s.pending.maxLength = DefaultMaxLineLength
+	s.maxBatch = readerSourceBuffer
+	go s.read(r)
+	return s
+}
+
+// NewStdinSource constructs a source reading lines from standard input, for
+// example the output of `kubectl logs -f` piped into the monitor.
+func NewStdinSource() *ReaderSource {
+	return NewReaderSource(os.Stdin)
+}
+
+// NewFIFOSource constructs a source reading lines from the named pipe at path.
+// The pipe is opened for writing as well as reading so that the source keeps
+// waiting for lines, rather than ending, when the last writer goes away.
+func NewFIFOSource(path string) (*ReaderSource, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return nil, errors.New(path + " is not a named pipe!")
+	}
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	return newReaderSource(f, path), nil
+}
+
+func (s *ReaderSource) read(r io.Reader) {
+	defer close(s.lines)
+	reader := bufio.NewReader(r)
+	var offset int64 // Bytes read so far
+	for {
+		chunk, err := reader.ReadSlice('\n')
+		offset += int64(len(chunk))
+		s.mu.Lock()
+		s.pending.add(chunk)
+		s.mu.Unlock()
+		if err == bufio.ErrBufferFull {
+			continue
+		}
+		if err == nil || s.pending.size > 0 {
+			start := offset - s.pending.size
+			if line, ok := s.line(); ok {
+				select {
+				case s.lines <- LogEntry{Source: s.name, Text: line, Offset: start}:
+				case <-s.done:
+					s.stop(io.EOF)
+					return
+				}
+			}
+		}
+		if err != nil {
+			select {
+			case <-s.done:
+				// Closed on purpose, not a read failure.
+				err = io.EOF
+			default:
+			}
+			s.stop(err)
+			return
+		}
+	}
+}
+
+// stop records why reading stopped.
+func (s *ReaderSource) stop(err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.err = err
+}
+
+func (s *ReaderSource) line() (string, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending.line()
+}
+
+// SetMaxBatchSize sets the most lines GetNewLogEntries returns at once. It
+// defaults to readerSourceBuffer, and zero means no limit.
+func (s *ReaderSource) SetMaxBatchSize(n int) {
+	s.maxBatch = n
+}
+
+// SetMaxLineLength sets the longest line, in bytes, the source returns, as
+// LogReader.SetMaxLineLength does. It applies from the next line read on.
+func (s *ReaderSource) SetMaxLineLength(n int, truncate bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending.maxLength = n
+	s.pending.truncate = truncate
+}
+
+// OversizedLines returns how many lines were longer than the maximum line length.
+func (s *ReaderSource) OversizedLines() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.pending.oversized
+}
+
+// GetNewLogEntries returns the lines read since the last call. It returns
+// io.EOF after the last line once the reader has ended, or the error that
+// stopped it.
+func (s *ReaderSource) GetNewLogEntries() ([]string, error) {
+	entries, err := s.GetNewEntries()
+	return entryTexts(entries), err
+}
+
+// GetNewEntries works like GetNewLogEntries, returning each line along with its
+// offset in the stream. Only sources reading a named pipe have a source name.
+func (s *ReaderSource) GetNewEntries() ([]LogEntry, error) {
+	var entries []LogEntry
+	for {
+		select {
+		case line, ok := <-s.lines:
+			if !ok {
+				s.mu.Lock()
+				err := s.err
+				s.mu.Unlock()
+				return entries, err
+			}
+			entries = append(entries, line)
+			if len(entries) == s.maxBatch {
+				return entries, nil
+			}
+		default:
+			return entries, nil
+		}
+	}
+}
+
+// Close stops reading and closes the underlying reader if it can be closed.
+// Afterwards GetNewLogEntries reports io.EOF.
+func (s *ReaderSource) Close() error {
+	var err error
+	s.once.Do(func() {
+		close(s.done)
+		if s.closer != nil {
+			err = s.closer.Close()
+		}
+	})
+	return err
+}
+
+// ProcessSource reads src until it ends or ctx is done, processing every line.
+// When there are no new lines it waits pollInterval before asking again. Lines
+// that can not be parsed are logged and skipped, and quarantined along with
+// their source and offset when src is an EntrySource. It returns nil when the
+// source ends, and the error otherwise.
+func (stats *LogStats) ProcessSource(ctx context.Context, src LogSource, pollInterval time.Duration) error {
+	poll := &pollNotifier{interval: pollInterval}
+	for {
+		entries, err := getNewEntries(src)
+		for i := range entries {
+			e := &entries[i]
+			if perr := stats.ProcessEntryAt(e.Source, e.Offset, &e.Text); perr != nil {
+				log.Println("Failed to process log entry: ", perr)
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			if err := poll.wait(ctx); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+// getNewEntries reads the new lines of src, with their offsets if it knows them.
+func getNewEntries(src LogSource) ([]LogEntry, error) {
+	if es, ok := src.(EntrySource); ok {
+		return es.GetNewEntries()
+	}
+	lines, err := src.GetNewLogEntries()
+	var entries []LogEntry
+	for _, line := range lines {
+		entries = append(entries, LogEntry{Text: line, Offset: -1})
+	}
+	return entries, err
+}
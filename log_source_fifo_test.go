@@ -0,0 +1,58 @@
+//go:build unix
+
+package monitor
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestFIFOSource(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.fifo")
+	if err := syscall.Mkfifo(path, 0600); err != nil {
+		t.Skipf("Could not create a named pipe: %s", err)
+	}
+
+	src, err := NewFIFOSource(path)
+	if err != nil {
+		t.Errorf("Failed to open the named pipe! %s", err)
+		t.FailNow()
+	}
+	defer src.Close()
+
+	// Two writers one after the other, the source keeps reading across both.
+	for _, line := range []string{"one", "two"} {
+		w, err := os.OpenFile(path, os.O_WRONLY, 0)
+		if err != nil {
+			t.Errorf("Failed to open the pipe for writing! %s", err)
+			t.FailNow()
+		}
+		w.WriteString(line + "\n")
+		w.Close()
+
+		var entries []string
+		deadline := time.Now().Add(5 * time.Second)
+		for len(entries) == 0 && time.Now().Before(deadline) {
+			entries, err = src.GetNewLogEntries()
+			if err != nil {
+				t.Errorf("Unexpected error reading the pipe! %s", err)
+				t.FailNow()
+			}
+			time.Sleep(time.Millisecond)
+		}
+		if len(entries) != 1 || entries[0] != line {
+			t.Errorf("Expected [%s] but got %v", line, entries)
+		}
+	}
+}
+
+func TestFIFOSourceNotAPipe(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one")
+	if _, err := NewFIFOSource(fName); err == nil {
+		t.Errorf("Expected an error for a regular file!")
+	}
+}
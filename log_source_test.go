@@ -0,0 +1,147 @@
+package monitor
+
+import (
+	"context"
+	"io"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readAllEntries(t *testing.T, src LogSource) []string {
+	var all []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, err := src.GetNewLogEntries()
+		all = append(all, entries...)
+		if err == io.EOF {
+			return all
+		}
+		if err != nil {
+			t.Errorf("Unexpected error reading the source! %s", err)
+			return all
+		}
+		time.Sleep(time.Millisecond)
+	}
+	t.Errorf("Timed out waiting for the source to end")
+	return all
+}
+
+func TestReaderSource(t *testing.T) {
+	src := NewReaderSource(strings.NewReader("one\ntwo\r\nthree"))
+	defer src.Close()
+
+	all := readAllEntries(t, src)
+	expected := []string{"one", "two", "three"}
+	if len(all) != len(expected) {
+		t.Errorf("Expected %v but got %v instead.", expected, all)
+		t.FailNow()
+	}
+	for i := range expected {
+		if expected[i] != all[i] {
+			t.Errorf("Expected %s but got %s instead.", expected[i], all[i])
+		}
+	}
+	if _, err := src.GetNewLogEntries(); err != io.EOF {
+		t.Errorf("An ended source should keep returning io.EOF but got %v", err)
+	}
+}
+
+func TestReaderSourceLimits(t *testing.T) {
+	r, w := io.Pipe()
+	src := NewReaderSource(r)
+	defer src.Close()
+	src.SetMaxLineLength(5, false)
+	src.SetMaxBatchSize(2)
+	go func() {
+		w.Write([]byte("one\nmuch too long\ntwo\nthree\n"))
+		w.Close()
+	}()
+
+	var all []string
+	deadline := time.Now().Add(5 * time.Second)
+	for time.Now().Before(deadline) {
+		entries, err := src.GetNewLogEntries()
+		if len(entries) > 2 {
+			t.Errorf("Expected at most 2 lines at a time but got %v", entries)
+		}
+		all = append(all, entries...)
+		if err != nil {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	if strings.Join(all, ",") != "one,two,three" {
+		t.Errorf("Expected the long line to be skipped but got %v", all)
+	}
+	if src.OversizedLines() != 1 {
+		t.Errorf("Expected 1 oversized line but got %d", src.OversizedLines())
+	}
+}
+
+func TestReaderSourceClose(t *testing.T) {
+	r, w := io.Pipe()
+	src := NewReaderSource(r)
+	go w.Write([]byte("one\n"))
+
+	deadline := time.Now().Add(5 * time.Second)
+	var entries []string
+	for len(entries) == 0 && time.Now().Before(deadline) {
+		entries, _ = src.GetNewLogEntries()
+	}
+	if len(entries) != 1 {
+		t.Errorf("Expected a line from the pipe but got %v", entries)
+	}
+	src.Close()
+	if readAllEntries(t, src) != nil {
+		t.Errorf("Nothing should be read after closing the source!")
+	}
+}
+
+func TestReaderSourceCloseWhileFull(t *testing.T) {
+	src := NewReaderSource(strings.NewReader(strings.Repeat("line\n", readerSourceBuffer+1)))
+	deadline := time.Now().Add(5 * time.Second)
+	for len(src.lines) < readerSourceBuffer && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	src.Close()
+	if all := readAllEntries(t, src); len(all) > readerSourceBuffer+1 {
+		t.Errorf("Expected at most %d lines but got %d", readerSourceBuffer+1, len(all))
+	}
+}
+
+func TestProcessSource(t *testing.T) {
+	input := strings.Join([]string{
+		`127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "POST http://my.site.com/pages/create HTTP/1.0" 200 2326`,
+		`127.0.0.1 user-identifier frank [10/Oct/2000:13:55:37 -0700] "POST http://my.site.com/pets/create HTTP/1.0" 200 2326`,
+		"This is not a properly formatted string",
+	}, "\n")
+
+	stats := NewLogStatsDefault("my.site.com")
+	src := NewReaderSource(strings.NewReader(input))
+	defer src.Close()
+	if err := stats.ProcessSource(context.Background(), src, time.Millisecond); err != nil {
+		t.Errorf("Processing the source failed! %s", err)
+	}
+	if stats.TotalSiteRequests() != 2 {
+		t.Errorf("Expected 2 requests but got %d instead.", stats.TotalSiteRequests())
+	}
+}
+
+func TestProcessSourceLogReader(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, `127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "POST http://my.site.com/pages/create HTTP/1.0" 200 2326`)
+
+	stats := NewLogStatsDefault("my.site.com")
+	var src LogSource = NewLogReader(fName)
+	defer src.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := stats.ProcessSource(ctx, src, time.Millisecond); err != context.DeadlineExceeded {
+		t.Errorf("A file never ends, expected the context to stop processing but got %v", err)
+	}
+	if stats.TotalSiteRequests() != 1 {
+		t.Errorf("Expected 1 request but got %d instead.", stats.TotalSiteRequests())
+	}
+}
@@ -0,0 +1,58 @@
+package monitor
+
+import (
+	"context"
+	"log"
+)
+
+// Stream reads the file in a new goroutine and sends each new line, tagged with
+// the file name and its offset, on the returned channel, which buffers at most
+// bufferSize lines. Reading pauses while the buffer is full. Read errors are
+// sent on the error channel, after which the reader waits for the next change
+// and tries again. Both channels are closed once ctx is done. The LogReader
+// must not be used by anything else while it is streaming.
+func (l *LogReader) Stream(ctx context.Context, bufferSize int) (<-chan LogEntry, <-chan error) {
+	lines := make(chan LogEntry, bufferSize)
+	errs := make(chan error, 1)
+
+	go func() {
+		defer close(errs)
+		defer close(lines)
+		for {
+			entries, err := l.waitForNewEntries(ctx)
+			for _, e := range entries {
+				select {
+				case lines <- e:
+				case <-ctx.Done():
+					return
+				}
+			}
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				select {
+				case errs <- err:
+				case <-ctx.Done():
+					return
+				}
+				if l.notifier.wait(ctx) != nil {
+					return
+				}
+			}
+		}
+	}()
+
+	return lines, errs
+}
+
+// ProcessStream processes every line received on lines, from LogReader.Stream
+// or MultiLogReader.Stream, until the channel is closed. Lines that can not be
+// parsed are logged and skipped, and quarantined with their source and offset.
+func (stats *LogStats) ProcessStream(lines <-chan LogEntry) {
+	for e := range lines {
+		if err := stats.ProcessEntryAt(e.Source, e.Offset, &e.Text); err != nil {
+			log.Println("Failed to process log entry: ", err)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package monitor
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestStream(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "access.log")
+	writeLines(t, fName, "one", "two")
+
+	r := NewNotifyingLogReader(fName, 10*time.Millisecond)
+	defer r.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, errs := r.Stream(ctx, 1)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		appendLines(fName, "three")
+	}()
+
+	expected := []LogEntry{{fName, "one", 0}, {fName, "two", 4}, {fName, "three", 8}}
+	for _, e := range expected {
+		select {
+		case line := <-lines:
+			if line != e {
+				t.Errorf("Expected %v but got %v instead.", e, line)
+			}
+		case err := <-errs:
+			t.Errorf("Unexpected error while streaming! %s", err)
+		case <-time.After(5 * time.Second):
+			t.Errorf("Timed out waiting for %s", e.Text)
+			t.FailNow()
+		}
+	}
+
+	cancel()
+	for range lines {
+	}
+	if _, ok := <-errs; ok {
+		t.Errorf("The error channel should be closed after cancellation!")
+	}
+}
+
+func TestStreamErrors(t *testing.T) {
+	dir := t.TempDir()
+	fName := filepath.Join(dir, "access.log")
+	// A directory in place of the file can not be read.
+	if err := os.Mkdir(fName, 0755); err != nil {
+		t.Errorf("Could not create the directory! %s", err)
+		t.FailNow()
+	}
+
+	r := NewLogReader(fName)
+	r.notifier = &pollNotifier{interval: 10 * time.Millisecond}
+	defer r.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	lines, errs := r.Stream(ctx, 1)
+
+	select {
+	case err := <-errs:
+		if err == nil {
+			t.Errorf("Expected a read error!")
+		}
+	case <-time.After(5 * time.Second):
+		t.Errorf("Timed out waiting for a read error")
+	}
+
+	// Wait for the stream to stop before the reader is closed.
+	cancel()
+	for range lines {
+	}
+	for range errs {
+	}
+}
+
+func TestProcessStream(t *testing.T) {
+	lines := make(chan LogEntry, 3)
+	lines <- LogEntry{Text: `127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "POST http://my.site.com/pages/create HTTP/1.0" 200 2326`}
+	lines <- LogEntry{Text: "This is not a properly formatted string"}
+	lines <- LogEntry{Text: `127.0.0.1 user-identifier frank [10/Oct/2000:13:55:37 -0700] "POST http://my.site.com/pets/create HTTP/1.0" 200 2326`}
+	close(lines)
+
+	stats := NewLogStatsDefault("my.site.com")
+	stats.ProcessStream(lines)
+	if stats.TotalSiteRequests() != 2 {
+		t.Errorf("Expected 2 requests but got %d instead.", stats.TotalSiteRequests())
+	}
+}
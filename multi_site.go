@@ -0,0 +1,226 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// DefaultMaxSites is the most sites a MultiSiteStats without an allow-list
+// adds unless told otherwise.
+const DefaultMaxSites = 1000
+
+// MultiSiteStats keeps a LogStats for each site in a log shared by several
+// virtual hosts, so that one pass over the log monitors all of them. Each site
+// has its own sections, averages and high traffic alarm. Sites are added the
+// first time a request for them is seen, up to a maximum number of sites,
+// unless an allow-list is given, in which case only the sites on it are
+// monitored. Hosts are compared in lower case and without their port.
+type MultiSiteStats struct {
+	sites         map[string]*LogStats
+	allowList     bool
+	maxSites      int
+	rollingMin    int64
+	thresholdMin  float32
+	otherRequests int
+	parser        Parser
+	quarantine    *Quarantine
+	defaultHost   string
+}
+
+// NewMultiSiteStats creates a MultiSiteStats whose sites keep rolling averages
+// over rollingMin minutes and raise their alarm above thresholdMin accesses per
+// minute. When allowList is not empty, only the sites in it are monitored.
+func NewMultiSiteStats(rollingMin int64, thresholdMin float32, allowList ...string) *MultiSiteStats {
+	m := new(MultiSiteStats)
+	m.sites = make(map[string]*LogStats)
+	m.rollingMin = rollingMin
+	m.thresholdMin = thresholdMin
+	m.allowList = len(allowList) > 0
+	m.maxSites = DefaultMaxSites
+	for _, site := range allowList {
+		site = normalizeHost(site)
+		m.sites[site] = m.newSite(site)
+	}
+	return m
+}
+
+// NewMultiSiteStatsDefault uses the same rolling average and threshold as
+// NewLogStatsDefault for every site.
+func NewMultiSiteStatsDefault(allowList ...string) *MultiSiteStats {
+	return NewMultiSiteStats(2, 1.0, allowList...)
+}
+
+func (m *MultiSiteStats) newSite(site string) *LogStats {
+	stats := NewLogStats(site, NewOverallTimeAverage(), NewRollingTimeAverage(m.rollingMin), m.thresholdMin)
+	stats.parser = m.parser
+	return stats
+}
+
+// SetParser sets the parser used by ProcessEntry. The default is CommonParser.
+func (m *MultiSiteStats) SetParser(p Parser) {
+	m.parser = p
+	for _, stats := range m.sites {
+		stats.parser = p
+	}
+}
+
+// SetQuarantine sets where ProcessEntry sends the lines it can not process.
+func (m *MultiSiteStats) SetQuarantine(q *Quarantine) {
+	m.quarantine = q
+}
+
+// SetDefaultHost sets the site of requests whose target is just a path and
+// that were logged without a Host or virtual host field. Without it such
+// requests are counted as OtherRequests.
+func (m *MultiSiteStats) SetDefaultHost(host string) {
+	m.defaultHost = normalizeHost(host)
+}
+
+// SetMaxSites sets the most sites that are added as they are seen. Requests
+// for further sites are counted as OtherRequests. Zero means no limit.
+func (m *MultiSiteStats) SetMaxSites(n int) {
+	m.maxSites = n
+}
+
+// site returns the statistics for host, creating them if needed, or nil if
+// host is not monitored.
+func (m *MultiSiteStats) site(host string) *LogStats {
+	stats, ok := m.sites[host]
+	if !ok && !m.allowList && host != "" && (m.maxSites == 0 || len(m.sites) < m.maxSites) {
+		stats = m.newSite(host)
+		m.sites[host] = stats
+	}
+	return stats
+}
+
+// ProcessEntry parses a log entry and adds it to the statistics of the site it
+// was for.
+func (m *MultiSiteStats) ProcessEntry(e *string) error {
+	return m.ProcessEntryAt("", -1, e)
+}
+
+// ProcessEntryAt processes a log entry like ProcessEntry, saying where it came
+// from in case it has to be quarantined. offset is the entry's position in
+// source, or -1 when it is not known.
+func (m *MultiSiteStats) ProcessEntryAt(source string, offset int64, e *string) error {
+	var err error
+	if fast, ok := m.parser.(*FastParser); ok {
+		var entry *FastEntry
+		if entry, err = fast.ParseFast(*e); err == nil {
+			host := entry.Host
+			if host == "" {
+				host = m.defaultHost
+			}
+			if stats := m.site(host); stats != nil {
+				stats.processFastEntry(entry)
+			} else {
+				m.otherRequests++
+			}
+		}
+	} else {
+		var r *AccessRecord
+		r, err = m.Parser().Parse(*e)
+		if errors.Is(err, ErrHeaderLine) {
+			return nil
+		} else if err == nil {
+			err = m.ProcessRecord(r)
+		}
+	}
+
+	m.quarantine.report(source, offset, *e, err)
+	return err
+}
+
+// Parser returns the parser used by ProcessEntry.
+func (m *MultiSiteStats) Parser() Parser {
+	if m.parser == nil {
+		return CommonParser{}
+	}
+	return m.parser
+}
+
+// ProcessRecord adds an already parsed request to the statistics of the site
+// it was for. Records without a URL or a time are rejected.
+func (m *MultiSiteStats) ProcessRecord(r *AccessRecord) error {
+	if r.URL == nil {
+		return ErrMissingURL
+	}
+	if r.Time.IsZero() {
+		return ErrMissingTime
+	}
+	host := recordHost(r, m.defaultHost)
+	stats := m.site(host)
+	if stats == nil {
+		m.otherRequests++
+		return nil
+	}
+	resolved := *r
+	resolved.Host = host
+	return stats.ProcessRecord(&resolved)
+}
+
+// Site returns the statistics for a site, or nil if it is not monitored. The
+// host is normalized like the hosts in the log, so it may carry a port.
+func (m *MultiSiteStats) Site(host string) *LogStats {
+	return m.sites[normalizeHost(host)]
+}
+
+// Sites returns the names of the monitored sites in alphabetical order.
+func (m *MultiSiteStats) Sites() []string {
+	var names []string
+	for name := range m.sites {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// OtherRequests returns how many requests were for sites that are not
+// monitored, or had no host at all.
+func (m *MultiSiteStats) OtherRequests() int {
+	return m.otherRequests
+}
+
+// TotalRequests returns the total number of requests to monitored sites.
+func (m *MultiSiteStats) TotalRequests() int {
+	total := 0
+	for _, stats := range m.sites {
+		total += stats.TotalSiteRequests()
+	}
+	return total
+}
+
+// TopSites returns up to num of the sites with the most requests.
+func (m *MultiSiteStats) TopSites(num int) []NamedCount {
+	counts := make(map[string]int64)
+	for name, stats := range m.sites {
+		counts[name] = int64(stats.TotalSiteRequests())
+	}
+	return topCounts(counts, num)
+}
+
+// SitesInAlarm returns the sites whose high traffic alarm is set, in
+// alphabetical order.
+func (m *MultiSiteStats) SitesInAlarm() []string {
+	var alarms []string
+	for _, name := range m.Sites() {
+		if m.sites[name].HighTrafficAlarm() {
+			alarms = append(alarms, name)
+		}
+	}
+	return alarms
+}
+
+// PrintTopSites prints the request counts of up to num of the busiest sites,
+// each followed by the statistics of up to sections of its most popular
+// sections.
+func (m *MultiSiteStats) PrintTopSites(num int, sections int) {
+	for _, site := range m.TopSites(num) {
+		fmt.Println("##### Site", site.Name, "with", site.Count, "requests #####")
+		if m.sites[site.Name].HighTrafficAlarm() {
+			fmt.Println("HIGH TRAFFIC ALARM SET")
+		}
+		m.sites[site.Name].PrintPopulartSections(sections)
+	}
+}
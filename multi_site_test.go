@@ -0,0 +1,126 @@
+package monitor
+
+import (
+	"fmt"
+	"testing"
+)
+
+func multiSiteLine(host string, minute int, second int) string {
+	return fmt.Sprintf(`127.0.0.1 - - [10/Oct/2000:13:%02d:%02d -0700] "GET http://%s/pages/create HTTP/1.0" 200 100`, minute, second, host)
+}
+
+func TestMultiSiteStats(t *testing.T) {
+	m := NewMultiSiteStatsDefault()
+	entries := []string{
+		multiSiteLine("a.site.com", 0, 0),
+		multiSiteLine("b.site.com", 0, 0),
+		multiSiteLine("a.site.com", 0, 10),
+		multiSiteLine("a.site.com", 0, 20),
+		"garbage",
+	}
+	for i := range entries {
+		m.ProcessEntry(&entries[i])
+	}
+
+	if sites := m.Sites(); len(sites) != 2 || sites[0] != "a.site.com" || sites[1] != "b.site.com" {
+		t.Errorf("Expected both sites to be monitored but got %v", sites)
+	}
+	if m.Site("a.site.com").TotalSiteRequests() != 3 || m.Site("b.site.com").TotalSiteRequests() != 1 {
+		t.Errorf("Unexpected request counts %v", m.TopSites(2))
+	}
+	if top := m.TopSites(1); len(top) != 1 || top[0].Name != "a.site.com" || top[0].Count != 3 {
+		t.Errorf("Expected a.site.com to be the top site but got %v", top)
+	}
+	if m.TotalRequests() != 4 || m.OtherRequests() != 0 {
+		t.Errorf("Expected 4 requests and no others but got %d and %d", m.TotalRequests(), m.OtherRequests())
+	}
+	if alarms := m.SitesInAlarm(); len(alarms) != 1 || alarms[0] != "a.site.com" {
+		t.Errorf("Expected only a.site.com to be in alarm but got %v", alarms)
+	}
+	if m.Site("c.site.com") != nil {
+		t.Errorf("Expected no statistics for a site that was never seen!")
+	}
+}
+
+func TestMultiSiteStatsAllowList(t *testing.T) {
+	m := NewMultiSiteStats(2, 1.0, "a.site.com", "quiet.site.com")
+	m.SetParser(NewFastParser())
+	entries := []string{
+		multiSiteLine("a.site.com", 0, 0),
+		multiSiteLine("b.site.com", 0, 0),
+		multiSiteLine("a.site.com", 1, 0),
+	}
+	for i := range entries {
+		if err := m.ProcessEntry(&entries[i]); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+
+	if sites := m.Sites(); len(sites) != 2 || sites[1] != "quiet.site.com" {
+		t.Errorf("Expected only the allowed sites but got %v", sites)
+	}
+	if m.Site("a.site.com").TotalSiteRequests() != 2 || m.Site("quiet.site.com").TotalSiteRequests() != 0 {
+		t.Errorf("Unexpected request counts %v", m.TopSites(2))
+	}
+	if m.OtherRequests() != 1 {
+		t.Errorf("Expected 1 request to another site but got %d", m.OtherRequests())
+	}
+	if m.Site("a.site.com").Parser().Name() != "fast-combined" {
+		t.Errorf("Expected the sites to share the parser!")
+	}
+}
+
+func TestMultiSiteStatsRecord(t *testing.T) {
+	m := NewMultiSiteStatsDefault()
+	m.SetParser(NewIISParser())
+	entries := []string{
+		"#Fields: date time cs-host cs-method cs-uri-stem sc-status",
+		"2026-10-16 08:00:01 a.site.com GET /pages/a 200",
+		"2026-10-16 08:00:02 b.site.com GET /pages/b 200",
+	}
+	for i := range entries {
+		if err := m.ProcessEntry(&entries[i]); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if len(m.Sites()) != 2 || m.TotalRequests() != 2 {
+		t.Errorf("Expected 2 sites with a request each but got %v", m.TopSites(10))
+	}
+}
+
+func TestMultiSiteStatsDefaultHost(t *testing.T) {
+	m := NewMultiSiteStatsDefault()
+	origin := `127.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET /pages/create HTTP/1.0" 200 2326`
+	m.ProcessEntry(&origin)
+	if m.OtherRequests() != 1 || len(m.Sites()) != 0 {
+		t.Errorf("Expected a request without a host to be counted as other!")
+	}
+	m.SetDefaultHost("my.site.com")
+	m.ProcessEntry(&origin)
+	if s := m.Site("my.site.com"); s == nil || s.TotalSiteRequests() != 1 {
+		t.Errorf("Expected the request to count towards the default host!")
+	}
+}
+
+func TestMultiSiteStatsHostsAndLimit(t *testing.T) {
+	m := NewMultiSiteStatsDefault()
+	m.SetMaxSites(2)
+	entries := []string{
+		multiSiteLine("A.Site.com:8080", 0, 0),
+		multiSiteLine("a.site.com", 0, 1),
+		multiSiteLine("[::1]:8443", 0, 2),
+		multiSiteLine("b.site.com", 0, 3),
+		multiSiteLine("c.site.com", 0, 4),
+	}
+	for i := range entries {
+		if err := m.ProcessEntry(&entries[i]); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if sites := m.Sites(); len(sites) != 2 || sites[0] != "::1" || sites[1] != "a.site.com" {
+		t.Errorf("Expected two sites with normalized hosts but got %v", sites)
+	}
+	if m.Site("A.Site.com:8080").TotalSiteRequests() != 2 || m.OtherRequests() != 2 {
+		t.Errorf("Expected 2 requests for a.site.com and 2 others but got %v and %d", m.TopSites(2), m.OtherRequests())
+	}
+}
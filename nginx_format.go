@@ -0,0 +1,214 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// NginxCombinedFormat is the format of nginx's predefined "combined" log_format.
+const NginxCombinedFormat = `$remote_addr - $remote_user [$time_local] "$request" $status $body_bytes_sent "$http_referer" "$http_user_agent"`
+
+var nginxVariable = regexp.MustCompile(`\$(\{[a-zA-Z0-9_]+\}|[a-zA-Z0-9_]+)`)
+
+// NginxParser parses lines written by nginx with a given log_format. Variables
+// with a counterpart in AccessRecord are mapped onto it and every other
+// variable is kept in Extra under its name without the "$".
+type NginxParser struct {
+	name      string
+	variables []string
+	re        *regexp.Regexp
+	jsonQuote bool
+}
+
+// CompileNginxFormat compiles the format string of a log_format directive.
+// escape is the directive's escape parameter: "default", "json" or "none".
+func CompileNginxFormat(name string, format string, escape string) (*NginxParser, error) {
+	if escape != "" && escape != "default" && escape != "json" && escape != "none" {
+		return nil, errors.New("Unknown nginx escape mode " + escape)
+	}
+	p := &NginxParser{name: name, jsonQuote: escape == "json"}
+
+	var expr strings.Builder
+	expr.WriteString("^")
+	last := 0
+	for _, loc := range nginxVariable.FindAllStringSubmatchIndex(format, -1) {
+		expr.WriteString(regexp.QuoteMeta(format[last:loc[0]]))
+		v := strings.Trim(format[loc[2]:loc[3]], "{}")
+		p.variables = append(p.variables, v)
+		expr.WriteString("(.*?)")
+		last = loc[1]
+	}
+	expr.WriteString(regexp.QuoteMeta(format[last:]))
+	expr.WriteString("$")
+	if len(p.variables) == 0 {
+		return nil, errors.New("The log_format " + name + " has no variables!")
+	}
+
+	re, err := regexp.Compile(expr.String())
+	if err != nil {
+		return nil, err
+	}
+	p.re = re
+	return p, nil
+}
+
+// Name implements Parser.
+func (p *NginxParser) Name() string {
+	return "nginx:" + p.name
+}
+
+// Parse implements Parser.
+func (p *NginxParser) Parse(line string) (*AccessRecord, error) {
+	m := p.re.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("%w: nginx log_format %s: %s", ErrFormatMismatch, p.name, line)
+	}
+
+	r := new(AccessRecord)
+	values := make(map[string]string)
+	for i, name := range p.variables {
+		values[name] = p.unescape(m[i+1])
+	}
+	if err := fillFromVariables(r, values, nginxFields); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+func (p *NginxParser) unescape(v string) string {
+	if p.jsonQuote {
+		if u, err := strconv.Unquote(`"` + v + `"`); err == nil {
+			return u
+		}
+		return v
+	}
+	// By default nginx writes quotes, backslashes and unprintable bytes as \xHH.
+	if !strings.Contains(v, `\x`) {
+		return v
+	}
+	var b strings.Builder
+	for i := 0; i < len(v); i++ {
+		if v[i] == '\\' && i+3 < len(v) && v[i+1] == 'x' {
+			if c, err := strconv.ParseUint(v[i+2:i+4], 16, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(v[i])
+	}
+	return b.String()
+}
+
+var nginxFields = map[string]recordField{
+	"time_local":      fieldTimeCLF,
+	"time_iso8601":    fieldTimeISO8601,
+	"msec":            fieldTimeEpoch,
+	"remote_addr":     fieldClient,
+	"request":         fieldRequest,
+	"request_method":  fieldMethod,
+	"request_uri":     fieldURI,
+	"uri":             fieldURI,
+	"host":            fieldHost,
+	"http_host":       fieldHostHeader,
+	"server_name":     fieldServerName,
+	"status":          fieldStatus,
+	"body_bytes_sent": fieldBytes,
+	"bytes_sent":      fieldBytesTotal,
+	"http_referer":    fieldReferer,
+	"http_user_agent": fieldUserAgent,
+	"request_time":    fieldDurationSeconds,
+}
+
+// LoadNginxFormats reads an nginx configuration file and compiles every
+// log_format directive in it, keyed by the format's name. The predefined
+// "combined" format is always included.
+func LoadNginxFormats(confPath string) (map[string]*NginxParser, error) {
+	data, err := os.ReadFile(confPath)
+	if err != nil {
+		return nil, err
+	}
+	formats := make(map[string]*NginxParser)
+	p, _ := CompileNginxFormat("combined", NginxCombinedFormat, "default")
+	formats["combined"] = p
+
+	directives, err := nginxDirectives(string(data), "log_format")
+	if err != nil {
+		return nil, err
+	}
+	for _, args := range directives {
+		if len(args) < 2 {
+			return nil, errors.New("log_format needs a name and a format")
+		}
+		name, escape := args[0], "default"
+		args = args[1:]
+		if strings.HasPrefix(args[0], "escape=") {
+			escape = strings.TrimPrefix(args[0], "escape=")
+			args = args[1:]
+		}
+		p, err := CompileNginxFormat(name, strings.Join(args, ""), escape)
+		if err != nil {
+			return nil, err
+		}
+		formats[name] = p
+	}
+	return formats, nil
+}
+
+// nginxDirectives returns the arguments of every directive called name in conf.
+func nginxDirectives(conf string, name string) ([][]string, error) {
+	var directives [][]string
+	var current []string
+	inDirective := false
+	for i := 0; i < len(conf); {
+		c := conf[i]
+		switch {
+		case c == '#':
+			for i < len(conf) && conf[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == ';' || c == '{' || c == '}':
+			if inDirective {
+				directives = append(directives, current)
+			}
+			current, inDirective = nil, false
+			i++
+		case c == '\'' || c == '"':
+			var b strings.Builder
+			j := i + 1
+			for ; j < len(conf) && conf[j] != c; j++ {
+				if conf[j] == '\\' && j+1 < len(conf) && (conf[j+1] == c || conf[j+1] == '\\') {
+					j++
+				}
+				b.WriteByte(conf[j])
+			}
+			if j >= len(conf) {
+				return nil, errors.New("Unterminated quote in nginx configuration")
+			}
+			if inDirective {
+				current = append(current, b.String())
+			}
+			i = j + 1
+		default:
+			j := i
+			for j < len(conf) && !strings.ContainsRune(" \t\r\n;{}", rune(conf[j])) {
+				j++
+			}
+			word := conf[i:j]
+			if current == nil && !inDirective {
+				inDirective = word == name
+				current = []string{}
+			} else if inDirective {
+				current = append(current, word)
+			}
+			i = j
+		}
+	}
+	return directives, nil
+}
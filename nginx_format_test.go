@@ -0,0 +1,150 @@
+package monitor
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestCompileNginxFormatCombined(t *testing.T) {
+	p, err := CompileNginxFormat("combined", NginxCombinedFormat, "default")
+	if err != nil {
+		t.Errorf("Failed to compile the format! %s", err)
+		t.FailNow()
+	}
+	r, err := p.Parse(`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/a HTTP/1.1" 200 512 "-" "Agent \x22quoted\x22"`)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Host != "my.site.com" || r.Status != 200 || r.Bytes != 512 || r.Referer != "" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.UserAgent != `Agent "quoted"` {
+		t.Errorf("Expected the \\x22 escapes to be decoded but got %s", r.UserAgent)
+	}
+	if p.Name() != "nginx:combined" {
+		t.Errorf("Unexpected parser name %s", p.Name())
+	}
+}
+
+func TestCompileNginxFormatCustom(t *testing.T) {
+	format := `$remote_addr [$time_iso8601] $host "$request_method $request_uri" $status $body_bytes_sent rt=$request_time urt="$upstream_response_time" ${request_id}`
+	p, err := CompileNginxFormat("timed", format, "")
+	if err != nil {
+		t.Errorf("Failed to compile the format! %s", err)
+		t.FailNow()
+	}
+	r, err := p.Parse(`10.0.0.1 [2026-10-16T08:00:00.250+00:00] my.site.com "POST /pages/create?x=1" 201 0 rt=0.125 urt="0.100, 0.020" abc123`)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Host != "my.site.com" || r.Method != "POST" || r.URL.Path != "/pages/create" || r.Status != 201 {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.Duration != 125*time.Millisecond {
+		t.Errorf("Expected a duration of 125ms but got %s", r.Duration)
+	}
+	if r.Time.UnixMilli() != time.Date(2026, 10, 16, 8, 0, 0, 250e6, time.UTC).UnixMilli() {
+		t.Errorf("Unexpected time %s", r.Time)
+	}
+	if r.Extra["upstream_response_time"] != "0.100, 0.020" || r.Extra["request_id"] != "abc123" {
+		t.Errorf("Expected unknown variables to be kept as extras but got %v", r.Extra)
+	}
+
+	if _, err := p.Parse("garbage"); err == nil {
+		t.Errorf("Expected an error for a line that does not match!")
+	}
+}
+
+func TestCompileNginxFormatJSON(t *testing.T) {
+	format := `{"time":"$msec","host":"$host","request":"$request","status":$status,"agent":"$http_user_agent"}`
+	p, err := CompileNginxFormat("json", format, "json")
+	if err != nil {
+		t.Errorf("Failed to compile the format! %s", err)
+		t.FailNow()
+	}
+	r, err := p.Parse(`{"time":"1760601600.123","host":"my.site.com","request":"GET /a HTTP/1.1","status":200,"agent":"say \"hi\""}`)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Time.UnixMilli() != 1760601600123 || r.UserAgent != `say "hi"` {
+		t.Errorf("Unexpected record %+v", r)
+	}
+
+	if _, err := CompileNginxFormat("bad", format, "xml"); err == nil {
+		t.Errorf("Expected an error for an unknown escape mode!")
+	}
+	if _, err := CompileNginxFormat("bad", "no variables", ""); err == nil {
+		t.Errorf("Expected an error for a format without variables!")
+	}
+}
+
+func TestLoadNginxFormats(t *testing.T) {
+	conf := `
+http {
+    # log_format commented '$status';
+    log_format main '$remote_addr - $remote_user [$time_local] "$request" '
+                    '$status $body_bytes_sent "$http_referer" '
+                    '"$http_user_agent" $request_time';
+    log_format  api  escape=json
+        '{"host":"$host","uri":"$request_uri","status":"$status"}';
+
+    server {
+        access_log /var/log/nginx/access.log main;
+    }
+}
+`
+	path := filepath.Join(t.TempDir(), "nginx.conf")
+	os.WriteFile(path, []byte(conf), 0644)
+
+	formats, err := LoadNginxFormats(path)
+	if err != nil {
+		t.Errorf("Failed to load the formats! %s", err)
+		t.FailNow()
+	}
+	if len(formats) != 3 || formats["main"] == nil || formats["api"] == nil || formats["combined"] == nil {
+		t.Errorf("Expected the main, api and combined formats but got %v", formats)
+		t.FailNow()
+	}
+
+	r, err := formats["main"].Parse(`10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/a HTTP/1.1" 200 512 "-" "curl" 0.003`)
+	if err != nil || r.Duration != 3*time.Millisecond {
+		t.Errorf("Expected the main format to parse with a duration but got %+v (%v)", r, err)
+	}
+	r, err = formats["api"].Parse(`{"host":"api.site.com","uri":"/v1/items","status":"404"}`)
+	if err != nil || r.Host != "api.site.com" || r.Status != 404 {
+		t.Errorf("Expected the api format to parse but got %+v (%v)", r, err)
+	}
+
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(formats["main"])
+	line := `10.0.0.1 - - [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/a HTTP/1.1" 200 512 "-" "curl" 0.003`
+	if err := stats.ProcessEntry(&line); err != nil {
+		t.Errorf("Failed to process log entry! %s", err)
+	}
+	if d := stats.PopularSections()[0].AverageDuration(); d != 3*time.Millisecond {
+		t.Errorf("Expected an average response time of 3ms but got %s", d)
+	}
+}
+
+func TestNginxFormatWithoutTime(t *testing.T) {
+	p, err := CompileNginxFormat("notime", `$remote_addr "$request" $status`, "")
+	if err != nil {
+		t.Errorf("Failed to compile the format! %s", err)
+		t.FailNow()
+	}
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(p)
+	line := `127.0.0.1 "GET http://my.site.com/pages/create HTTP/1.1" 200`
+	if err := stats.ProcessEntry(&line); !errors.Is(err, ErrMissingTime) {
+		t.Errorf("Expected ErrMissingTime for a line without a time but got %v", err)
+	}
+	if stats.TotalSiteRequests() != 0 {
+		t.Errorf("Expected a line without a time not to be counted!")
+	}
+}
@@ -0,0 +1,439 @@
+package monitor
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/acidleroy/logparse"
+)
+
+// AccessRecord is a single request read from an access log, whatever format
+// the log was written in. Fields a format does not record are left empty.
+type AccessRecord struct {
+	Time      time.Time
+	Client    string
+	Method    string
+	URL       *url.URL
+	Host      string
+	Status    int
+	Bytes     int64
+	Referer   string
+	UserAgent string
+	// Duration is how long the request took to serve, when HasDuration says it
+	// was logged. A duration of zero is as real as any other.
+	Duration    time.Duration
+	HasDuration bool
+	// Extra holds fields specific to a format, keyed by their name in it.
+	Extra map[string]string
+}
+
+// ErrHeaderLine is returned by parsers for header and comment lines that hold
+// no request, such as the "#Fields:" line of a W3C log. ProcessEntry skips them.
+var ErrHeaderLine = errors.New("The line is a header, not a request")
+
+// The kinds of error parsers return for lines they can not parse, wrapped with
+// the details of the line. Use errors.Is to tell them apart.
+var (
+	ErrFormatMismatch   = errors.New("Line does not match the format")
+	ErrFieldCount       = errors.New("Wrong number of fields")
+	ErrUnterminated     = errors.New("Unterminated field")
+	ErrMalformedRequest = errors.New("Malformed request line")
+	ErrInvalidValue     = errors.New("Invalid value")
+	ErrMissingURL       = errors.New("The line has no request URL")
+	ErrMissingTime      = errors.New("The line has no request time")
+	ErrMissingHeader    = errors.New("No #Fields directive has been read")
+)
+
+// Parser turns a line of an access log into an AccessRecord.
+type Parser interface {
+	// Name identifies the parser in the registry.
+	Name() string
+	Parse(line string) (*AccessRecord, error)
+}
+
+var (
+	parsersMu   sync.RWMutex
+	parserNames []string
+	parsers     = make(map[string]Parser)
+)
+
+func init() {
+	RegisterParser(new(CombinedParser))
+	RegisterParser(new(CommonParser))
+	RegisterParser(new(ALBParser))
+	RegisterParser(new(ELBParser))
+	RegisterParser(new(CloudFrontParser))
+	RegisterParser(new(HAProxyParser))
+	RegisterParser(new(EnvoyParser))
+	RegisterParser(new(CaddyParser))
+	vhost, _ := CompileApacheFormat("vhost_combined", ApacheVhostCombinedFormat)
+	RegisterParser(vhost)
+}
+
+// RegisterParser adds p to the registry, replacing any parser of the same name.
+// When several parsers match a sample equally well, DetectParser prefers the
+// one registered first, so more specific formats should be registered before
+// more general ones.
+func RegisterParser(p Parser) {
+	parsersMu.Lock()
+	defer parsersMu.Unlock()
+	if _, ok := parsers[p.Name()]; !ok {
+		parserNames = append(parserNames, p.Name())
+	}
+	parsers[p.Name()] = p
+}
+
+// LookupParser returns the registered parser called name.
+func LookupParser(name string) (Parser, error) {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	p, ok := parsers[name]
+	if !ok {
+		return nil, errors.New("No parser named " + name + " is registered!")
+	}
+	return p, nil
+}
+
+// Parsers returns every registered parser in the order they were registered.
+func Parsers() []Parser {
+	parsersMu.RLock()
+	defer parsersMu.RUnlock()
+	var all []Parser
+	for _, name := range parserNames {
+		all = append(all, parsers[name])
+	}
+	return all
+}
+
+// DetectParser returns the registered parser that parses the most lines of
+// sample, or an error if none of them parse any.
+func DetectParser(sample []string) (Parser, error) {
+	var best Parser
+	bestCount := 0
+	for _, p := range Parsers() {
+		count := 0
+		for _, line := range sample {
+			if _, err := p.Parse(line); err == nil {
+				count++
+			}
+		}
+		if count > bestCount {
+			best, bestCount = p, count
+		}
+	}
+	if best == nil {
+		return nil, errors.New("None of the registered parsers match the sample!")
+	}
+	return best, nil
+}
+
+// AutoDetectParser works out the format of a log from its first lines. Each of
+// the first sampleSize lines is tried against every registered parser and
+// parsed by whichever has matched the most lines so far. After that the best
+// parser is locked in and used on its own.
+type AutoDetectParser struct {
+	sampleSize int
+	seen       int
+	candidates []Parser
+	matches    []int
+	locked     Parser
+}
+
+// NewAutoDetectParser constructs a parser that locks in a format after
+// sampleSize lines.
+func NewAutoDetectParser(sampleSize int) *AutoDetectParser {
+	a := new(AutoDetectParser)
+	a.sampleSize = sampleSize
+	a.candidates = Parsers()
+	a.matches = make([]int, len(a.candidates))
+	return a
+}
+
+// Name implements Parser.
+func (a *AutoDetectParser) Name() string {
+	return "auto"
+}
+
+// Locked returns the parser that was locked in, or nil while still sampling.
+func (a *AutoDetectParser) Locked() Parser {
+	return a.locked
+}
+
+// Parse implements Parser.
+func (a *AutoDetectParser) Parse(line string) (*AccessRecord, error) {
+	if a.locked != nil {
+		return a.locked.Parse(line)
+	}
+
+	records := make([]*AccessRecord, len(a.candidates))
+	var firstErr error
+	header := false
+	for i, p := range a.candidates {
+		r, err := p.Parse(line)
+		if err != nil {
+			if firstErr == nil {
+				firstErr = err
+			}
+			header = header || errors.Is(err, ErrHeaderLine)
+			continue
+		}
+		records[i] = r
+		a.matches[i]++
+	}
+
+	best := -1
+	for i := range a.candidates {
+		if a.matches[i] > 0 && (best < 0 || a.matches[i] > a.matches[best]) {
+			best = i
+		}
+	}
+	a.seen++
+	if a.seen >= a.sampleSize && best >= 0 {
+		a.locked = a.candidates[best]
+	}
+
+	if best >= 0 && records[best] != nil {
+		return records[best], nil
+	}
+	for _, r := range records {
+		if r != nil {
+			return r, nil
+		}
+	}
+	// A header for any of the candidates is skipped rather than rejected.
+	if header {
+		return nil, ErrHeaderLine
+	}
+	if firstErr == nil {
+		firstErr = errors.New("No parsers are registered!")
+	}
+	return nil, firstErr
+}
+
+// CommonParser parses the NCSA Common Log Format with logparse.Common.
+type CommonParser struct{}
+
+// Name implements Parser.
+func (CommonParser) Name() string {
+	return "common"
+}
+
+// Parse implements Parser.
+func (CommonParser) Parse(line string) (*AccessRecord, error) {
+	l, err := logparse.Common(line)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrFormatMismatch, err)
+	}
+	r := &AccessRecord{
+		Time:   l.Time,
+		Client: l.Host.String(),
+		Method: l.Request.Method,
+		URL:    l.Request.URL,
+		Host:   l.Request.URL.Hostname(),
+	}
+	// A common log line always ends with the status and the size.
+	fields := strings.Fields(line)
+	if len(fields) >= 2 {
+		r.Status, _ = strconv.Atoi(fields[len(fields)-2])
+		r.Bytes, _ = strconv.ParseInt(fields[len(fields)-1], 10, 64)
+	}
+	return r, nil
+}
+
+// CombinedParser parses the Combined Log Format with ParseCombined.
+type CombinedParser struct{}
+
+// Name implements Parser.
+func (CombinedParser) Name() string {
+	return "combined"
+}
+
+// Parse implements Parser.
+func (CombinedParser) Parse(line string) (*AccessRecord, error) {
+	c, err := ParseCombined(line)
+	if err != nil {
+		return nil, err
+	}
+	return &AccessRecord{
+		Time:      c.Time,
+		Client:    c.Client,
+		Method:    c.Method,
+		URL:       c.URL,
+		Host:      c.URL.Hostname(),
+		Status:    c.Status,
+		Bytes:     c.Bytes,
+		Referer:   c.Referer,
+		UserAgent: c.UserAgent,
+		Extra:     map[string]string{"ident": c.Ident, "user": c.User, "protocol": c.Proto},
+	}, nil
+}
+
+// SetParser sets the parser used by ProcessEntry. The default is CommonParser.
+func (stats *LogStats) SetParser(p Parser) {
+	stats.parser = p
+}
+
+// Parser returns the parser used by ProcessEntry.
+func (stats *LogStats) Parser() Parser {
+	if stats.parser == nil {
+		return CommonParser{}
+	}
+	return stats.parser
+}
+
+// recordField says which AccessRecord field a log format variable fills in.
+type recordField int
+
+const (
+	fieldExtra recordField = iota
+	fieldTimeCLF
+	fieldTimeISO8601
+	fieldTimeEpoch
+	fieldTimeEpochMillis
+	fieldTimeEpochMicros
+	fieldClient
+	fieldRequest
+	fieldMethod
+	fieldURI
+	fieldHost       // The host the request was for
+	fieldHostHeader // The Host header, used when there is no fieldHost
+	fieldServerName // The server's configured name, used when there is nothing better
+	fieldStatus
+	fieldStatusOriginal // The status before internal redirects, used when there is no fieldStatus
+	fieldBytes
+	fieldBytesTotal // Bytes including headers, used when there is no fieldBytes
+	fieldReferer
+	fieldUserAgent
+	fieldDurationSeconds
+	fieldDurationMillis
+	fieldDurationMicros
+)
+
+// fallbackFields are only used when the field they stand in for has no value.
+var fallbackFields = map[recordField]recordField{
+	fieldHostHeader:     fieldHost,
+	fieldServerName:     fieldHostHeader,
+	fieldStatusOriginal: fieldStatus,
+	fieldBytesTotal:     fieldBytes,
+}
+
+// fillFromVariables sets the fields of r from the values of a log line's
+// variables, using fields to look up what each variable means. Variables with
+// no meaning are kept in Extra. "-" and empty values are treated as missing.
+func fillFromVariables(r *AccessRecord, values map[string]string, fields map[string]recordField) error {
+	present := make(map[recordField]string)
+	for name, v := range values {
+		f := fields[name]
+		if f == fieldExtra {
+			if r.Extra == nil {
+				r.Extra = make(map[string]string)
+			}
+			r.Extra[name] = v
+		} else if v != "-" && v != "" {
+			present[f] = v
+		}
+	}
+	for f := range present {
+		for better, ok := fallbackFields[f]; ok; better, ok = fallbackFields[better] {
+			if _, found := present[better]; found {
+				delete(present, f)
+				break
+			}
+		}
+	}
+
+	var err error
+	for f, v := range present {
+		switch f {
+		case fieldTimeCLF:
+			r.Time, err = time.Parse(clfTimeLayout, strings.Trim(v, "[]"))
+		case fieldTimeISO8601:
+			r.Time, err = time.Parse(time.RFC3339Nano, v)
+		case fieldTimeEpoch:
+			r.Time, err = parseEpoch(v)
+		case fieldTimeEpochMillis, fieldTimeEpochMicros:
+			var n int64
+			n, err = strconv.ParseInt(v, 10, 64)
+			if f == fieldTimeEpochMillis {
+				r.Time = time.UnixMilli(n)
+			} else {
+				r.Time = time.UnixMicro(n)
+			}
+		case fieldClient:
+			r.Client = v
+		case fieldRequest:
+			var u *url.URL
+			r.Method, u, _, err = parseRequestLine(v)
+			if err == nil && present[fieldURI] == "" {
+				r.URL = u
+			}
+		case fieldMethod:
+			r.Method = v
+		case fieldURI:
+			r.URL, err = url.ParseRequestURI(v)
+		case fieldHost, fieldHostHeader, fieldServerName:
+			r.Host = v
+		case fieldStatus, fieldStatusOriginal:
+			r.Status, err = strconv.Atoi(v)
+		case fieldBytes, fieldBytesTotal:
+			r.Bytes, err = strconv.ParseInt(v, 10, 64)
+		case fieldReferer:
+			r.Referer = v
+		case fieldUserAgent:
+			r.UserAgent = v
+		case fieldDurationSeconds, fieldDurationMillis, fieldDurationMicros:
+			r.Duration, err = parseDuration(v, f)
+			r.HasDuration = err == nil
+		}
+		if err != nil {
+			return fmt.Errorf("%w %q in log line: %s", ErrInvalidValue, v, err)
+		}
+	}
+
+	if r.URL == nil {
+		return ErrMissingURL
+	}
+	if r.Host == "" {
+		r.Host = r.URL.Hostname()
+	}
+	return nil
+}
+
+// parseEpoch parses seconds since the epoch with an optional fraction, such as
+// nginx's $msec.
+func parseEpoch(v string) (time.Time, error) {
+	secs, frac, _ := strings.Cut(v, ".")
+	s, err := strconv.ParseInt(secs, 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var nanos int64
+	if frac != "" {
+		frac = (frac + "000000000")[:9]
+		if nanos, err = strconv.ParseInt(frac, 10, 64); err != nil {
+			return time.Time{}, err
+		}
+	}
+	return time.Unix(s, nanos), nil
+}
+
+// parseDuration parses a duration logged in the unit given by f. Seconds may
+// have a fraction, milliseconds and microseconds are whole numbers.
+func parseDuration(v string, f recordField) (time.Duration, error) {
+	switch f {
+	case fieldDurationSeconds:
+		secs, err := strconv.ParseFloat(v, 64)
+		return time.Duration(secs * float64(time.Second)), err
+	case fieldDurationMillis:
+		ms, err := strconv.ParseInt(v, 10, 64)
+		return time.Duration(ms) * time.Millisecond, err
+	default:
+		us, err := strconv.ParseInt(v, 10, 64)
+		return time.Duration(us) * time.Microsecond, err
+	}
+}
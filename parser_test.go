@@ -0,0 +1,152 @@
+package monitor
+
+import (
+	"errors"
+	"testing"
+)
+
+const (
+	commonLine   = `127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/create HTTP/1.0" 200 2326`
+	combinedLine = `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/create HTTP/1.0" 200 2326 "-" "curl/8.0"`
+)
+
+func TestCommonParser(t *testing.T) {
+	r, err := CommonParser{}.Parse(commonLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Host != "my.site.com" || r.Method != "GET" || r.Status != 200 || r.Bytes != 2326 || r.Client != "127.0.0.1" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.Time.Unix() != 971211336 {
+		t.Errorf("Expected time 971211336 but got %d instead.", r.Time.Unix())
+	}
+}
+
+func TestCombinedParser(t *testing.T) {
+	r, err := CombinedParser{}.Parse(combinedLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Host != "my.site.com" || r.UserAgent != "curl/8.0" || r.Extra["user"] != "frank" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+}
+
+type testParser struct {
+	name string
+	err  error
+}
+
+func (p testParser) Name() string { return p.name }
+
+func (p testParser) Parse(line string) (*AccessRecord, error) {
+	if p.err != nil {
+		return nil, p.err
+	}
+	return CommonParser{}.Parse(commonLine)
+}
+
+func TestParserRegistry(t *testing.T) {
+	if _, err := LookupParser("combined"); err != nil {
+		t.Errorf("The combined parser should be registered! %s", err)
+	}
+	if _, err := LookupParser("no-such-format"); err == nil {
+		t.Errorf("Expected an error for an unknown parser!")
+	}
+
+	RegisterParser(testParser{name: "test-registry", err: errors.New("never matches")})
+	p, err := LookupParser("test-registry")
+	if err != nil || p.Name() != "test-registry" {
+		t.Errorf("Expected to find the registered parser but got %v (%v)", p, err)
+	}
+	RegisterParser(testParser{name: "test-registry", err: errors.New("never matches")})
+	found := 0
+	for _, p := range Parsers() {
+		if p.Name() == "test-registry" {
+			found++
+		}
+	}
+	if found != 1 {
+		t.Errorf("Expected the parser to be listed once but found it %d times", found)
+	}
+}
+
+func TestDetectParser(t *testing.T) {
+	p, err := DetectParser([]string{combinedLine, combinedLine, "garbage"})
+	if err != nil || p.Name() != "combined" {
+		t.Errorf("Expected to detect the combined format but got %v (%v)", p, err)
+	}
+	p, err = DetectParser([]string{commonLine, combinedLine, commonLine})
+	if err != nil || p.Name() != "common" {
+		t.Errorf("Expected to detect the common format but got %v (%v)", p, err)
+	}
+	if _, err := DetectParser([]string{"garbage"}); err == nil {
+		t.Errorf("Expected an error when nothing matches!")
+	}
+}
+
+func TestAutoDetectParser(t *testing.T) {
+	a := NewAutoDetectParser(2)
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(a)
+
+	for _, line := range []string{"garbage", combinedLine} {
+		v := line
+		stats.ProcessEntry(&v)
+	}
+	if a.Locked() == nil || a.Locked().Name() != "combined" {
+		t.Errorf("Expected the combined parser to be locked in but got %v", a.Locked())
+	}
+	v := commonLine
+	if err := stats.ProcessEntry(&v); err == nil {
+		t.Errorf("Expected the locked in parser to reject a common log line!")
+	}
+	if stats.TotalSiteRequests() != 1 {
+		t.Errorf("Expected 1 request but got %d instead.", stats.TotalSiteRequests())
+	}
+}
+
+func TestAutoDetectParserKeepsSampling(t *testing.T) {
+	a := NewAutoDetectParser(5)
+	if _, err := a.Parse("garbage"); err == nil {
+		t.Errorf("Expected an error for a line no parser understands!")
+	}
+	for i := 0; i < 5; i++ {
+		a.Parse("garbage")
+	}
+	if a.Locked() != nil {
+		t.Errorf("Nothing should be locked in before a line has matched!")
+	}
+	if _, err := a.Parse(commonLine); err != nil || a.Locked() == nil {
+		t.Errorf("Expected a parser to be locked in after a match (%v)", err)
+	}
+}
+
+func TestAutoDetectParserHeaderLine(t *testing.T) {
+	a := NewAutoDetectParser(5)
+	if _, err := a.Parse("#Version: 1.0"); err != ErrHeaderLine {
+		t.Errorf("Expected ErrHeaderLine while sampling but got %v", err)
+	}
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(a)
+	v := "#Fields: date time"
+	if err := stats.ProcessEntry(&v); err != nil {
+		t.Errorf("Expected the header line to be skipped but got %v", err)
+	}
+}
+
+func TestProcessRecord(t *testing.T) {
+	stats := NewLogStatsDefault("my.site.com")
+	r, _ := CommonParser{}.Parse(commonLine)
+	r.Host = "other.site.com"
+	stats.ProcessRecord(r)
+	if stats.TotalSiteRequests() != 0 {
+		t.Errorf("The record's host should decide the site!")
+	}
+	if err := stats.ProcessRecord(&AccessRecord{}); err == nil {
+		t.Errorf("Expected an error for a record without a URL!")
+	}
+}
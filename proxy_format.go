@@ -0,0 +1,155 @@
+package monitor
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// haproxyHTTPLog matches a line written with HAProxy's "option httplog", with
+// or without the syslog header in front of it.
+var haproxyHTTPLog = regexp.MustCompile(`^(?:.*?\]: )?(\S+) \[([^\]]+)\] (\S+) (\S+) (-?\d+)/(-?\d+)/(-?\d+)/(-?\d+)/\+?(-?\d+) (-?\d+) \+?(\d+) (\S+) (\S+) (\S+) (\S+) (\S+)(?: \{([^}]*)\})?(?: \{([^}]*)\})? "(.*)"$`)
+
+var haproxyFieldNames = []string{
+	"client:port", "accept_date", "frontend", "backend/server",
+	"Tq", "Tw", "Tc", "Tr", "Tt", "status_code", "bytes_read",
+	"captured_request_cookie", "captured_response_cookie", "termination_state",
+	"actconn/feconn/beconn/srv_conn/retries", "srv_queue/backend_queue",
+	"captured_request_headers", "captured_response_headers", "http_request",
+}
+
+var haproxyFields = map[string]recordField{
+	"client":       fieldClient,
+	"http_request": fieldRequest,
+	"status_code":  fieldStatus,
+	"bytes_read":   fieldBytes,
+}
+
+// HAProxyParser parses HAProxy's HTTP log format. The duration is the total
+// time Tt, and each of the Tq, Tw, Tc, Tr and Tt timers is kept in Extra in
+// milliseconds, with -1 for phases that never completed. The accept date is
+// read in the local time zone, as HAProxy writes it. When the request line
+// only has a path, the host is taken from the first captured request header,
+// which is where "capture request header Host" puts it when it comes first.
+// The remaining fields are kept in Extra under their name in the HAProxy docs.
+type HAProxyParser struct{}
+
+// Name implements Parser.
+func (HAProxyParser) Name() string {
+	return "haproxy"
+}
+
+// Parse implements Parser.
+func (HAProxyParser) Parse(line string) (*AccessRecord, error) {
+	m := haproxyHTTPLog.FindStringSubmatch(line)
+	if m == nil {
+		return nil, fmt.Errorf("%w: not an HAProxy HTTP log: %s", ErrFormatMismatch, line)
+	}
+
+	values := make(map[string]string)
+	for i, name := range haproxyFieldNames {
+		values[name] = m[i+1]
+	}
+	if i := strings.LastIndexByte(values["client:port"], ':'); i > 0 {
+		values["client"] = values["client:port"][:i]
+	}
+	delete(values, "client:port")
+
+	r := new(AccessRecord)
+	if err := fillFromVariables(r, values, haproxyFields); err != nil {
+		return nil, err
+	}
+	if headers := values["captured_request_headers"]; r.URL.Host == "" && headers != "" {
+		r.Host, _, _ = strings.Cut(headers, "|")
+	}
+	t, err := time.ParseInLocation("02/Jan/2006:15:04:05.000", values["accept_date"], time.Local)
+	if err != nil {
+		return nil, fmt.Errorf("%w for the accept date in HAProxy log line: %s", ErrInvalidValue, line)
+	}
+	r.Time = t
+	if tt, err := strconv.Atoi(values["Tt"]); err == nil && tt >= 0 {
+		r.Duration = time.Duration(tt) * time.Millisecond
+		r.HasDuration = true
+	}
+	return r, nil
+}
+
+var envoyFieldNames = []string{
+	"start_time", "request", "response_code", "response_flags", "bytes_received",
+	"bytes_sent", "duration", "x-envoy-upstream-service-time", "x-forwarded-for",
+	"user-agent", "x-request-id", "authority", "upstream_host",
+}
+
+var envoyFields = map[string]recordField{
+	"start_time":    fieldTimeISO8601,
+	"request":       fieldRequest,
+	"response_code": fieldStatus,
+	"bytes_sent":    fieldBytes,
+	"duration":      fieldDurationMillis,
+	"user-agent":    fieldUserAgent,
+	"authority":     fieldHost,
+}
+
+// EnvoyParser parses Envoy's default access log format. The host is the
+// request's :authority and the duration is Envoy's DURATION. The other fields
+// are kept in Extra under the lowercased name of their command operator or
+// header.
+type EnvoyParser struct{}
+
+// Name implements Parser.
+func (EnvoyParser) Name() string {
+	return "envoy"
+}
+
+// Parse implements Parser.
+func (EnvoyParser) Parse(line string) (*AccessRecord, error) {
+	fields, err := splitLogFields(line)
+	if err != nil {
+		return nil, err
+	}
+	if len(fields) != len(envoyFieldNames) {
+		return nil, fmt.Errorf("%w: expected %d in Envoy log line: %s", ErrFieldCount, len(envoyFieldNames), line)
+	}
+
+	values := make(map[string]string)
+	for i, name := range envoyFieldNames {
+		values[name] = fields[i]
+	}
+	r := new(AccessRecord)
+	if err := fillFromVariables(r, values, envoyFields); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+var caddyMapping = JSONFieldMapping{
+	Time:       "ts",
+	TimeFormat: "epoch",
+	Host:       "request.host",
+	Path:       "request.uri",
+	Status:     "status",
+	Bytes:      "size",
+	Duration:   "duration",
+	Method:     "request.method",
+	Client:     "request.remote_ip",
+	Referer:    "request.headers.Referer",
+	UserAgent:  "request.headers.User-Agent",
+}
+
+var caddyJSONParser, _ = NewJSONParser("caddy", caddyMapping)
+
+// CaddyParser parses the JSON access logs of Caddy 2. The other top level keys
+// of its entries, such as "logger" and "user_id", are kept in Extra.
+type CaddyParser struct{}
+
+// Name implements Parser.
+func (CaddyParser) Name() string {
+	return "caddy"
+}
+
+// Parse implements Parser.
+func (CaddyParser) Parse(line string) (*AccessRecord, error) {
+	return caddyJSONParser.Parse(line)
+}
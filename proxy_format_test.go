@@ -0,0 +1,109 @@
+package monitor
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+const haproxyLine = `Feb  6 12:14:14 localhost haproxy[14389]: 10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/srv1 10/0/30/69/+109 200 +2750 - - ---- 1/1/1/1/0 0/0 {my.site.com|Mozilla} {} "GET /pages/index.html HTTP/1.1"`
+
+const envoyLine = `[2016-04-15T20:17:00.310Z] "POST /api/v1/locations HTTP/2" 204 - 154 0 226 100 "10.0.35.28" "nsq2http" "cc21d9b0-cf5c-432b-8c7e-98aeb7988cd2" "my.site.com" "tcp://10.0.2.1:80"`
+
+const caddyLine = `{"level":"info","ts":1646861401.5241024,"logger":"http.log.access.log0","msg":"handled request","request":{"remote_ip":"127.0.0.1","remote_port":"41342","proto":"HTTP/2.0","method":"GET","host":"my.site.com","uri":"/pages/a?x=1","headers":{"User-Agent":["curl/7.82.0"],"Accept":["*/*"]}},"bytes_read":0,"user_id":"","duration":0.000929675,"size":10900,"status":200,"resp_headers":{"Server":["Caddy"]}}`
+
+func TestHAProxyParser(t *testing.T) {
+	r, err := HAProxyParser{}.Parse(haproxyLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if !r.Time.Equal(time.Date(2009, 2, 6, 12, 14, 14, 655e6, time.Local)) || r.Client != "10.0.1.2" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.Host != "my.site.com" || r.URL.Path != "/pages/index.html" || r.Method != "GET" {
+		t.Errorf("Unexpected host %s or request %s %s", r.Host, r.Method, r.URL)
+	}
+	if r.Status != 200 || r.Bytes != 2750 || r.Duration != 109*time.Millisecond {
+		t.Errorf("Unexpected status %d, bytes %d or duration %s", r.Status, r.Bytes, r.Duration)
+	}
+	for timer, expected := range map[string]string{"Tq": "10", "Tw": "0", "Tc": "30", "Tr": "69", "Tt": "109"} {
+		if r.Extra[timer] != expected {
+			t.Errorf("Expected %s to be %s but got %q", timer, expected, r.Extra[timer])
+		}
+	}
+	if r.Extra["backend/server"] != "static/srv1" || r.Extra["termination_state"] != "----" {
+		t.Errorf("Unexpected extras %v", r.Extra)
+	}
+
+	aborted := `10.0.1.2:33317 [06/Feb/2009:12:14:14.655] http-in static/<NOSRV> -1/-1/-1/-1/8 400 187 - - CR-- 1/1/0/0/0 0/0 "GET http://my.site.com/ HTTP/1.1"`
+	r, err = HAProxyParser{}.Parse(aborted)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Host != "my.site.com" || r.Duration != 8*time.Millisecond || r.Extra["Tr"] != "-1" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+
+	r, err = HAProxyParser{}.Parse(strings.Replace(aborted, "/8 400", "/0 400", 1))
+	if err != nil || !r.HasDuration || r.Duration != 0 {
+		t.Errorf("Expected a logged duration of 0 but got %+v (%v)", r, err)
+	}
+}
+
+func TestEnvoyParser(t *testing.T) {
+	r, err := EnvoyParser{}.Parse(envoyLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Time.UnixMilli() != 1460751420310 || r.Host != "my.site.com" || r.URL.Path != "/api/v1/locations" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.Status != 204 || r.Bytes != 0 || r.Duration != 226*time.Millisecond || r.UserAgent != "nsq2http" {
+		t.Errorf("Unexpected status %d, bytes %d, duration %s or user agent %s", r.Status, r.Bytes, r.Duration, r.UserAgent)
+	}
+	if r.Extra["x-envoy-upstream-service-time"] != "100" || r.Extra["upstream_host"] != "tcp://10.0.2.1:80" {
+		t.Errorf("Unexpected extras %v", r.Extra)
+	}
+}
+
+func TestCaddyParser(t *testing.T) {
+	r, err := CaddyParser{}.Parse(caddyLine)
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if r.Time.UnixMilli() != 1646861401524 || r.Host != "my.site.com" || r.URL.Path != "/pages/a" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.Status != 200 || r.Bytes != 10900 || r.Duration != 929675*time.Nanosecond {
+		t.Errorf("Unexpected status %d, bytes %d or duration %s", r.Status, r.Bytes, r.Duration)
+	}
+	if r.Method != "GET" || r.Client != "127.0.0.1" || r.UserAgent != "curl/7.82.0" {
+		t.Errorf("Unexpected method %s, client %s or user agent %s", r.Method, r.Client, r.UserAgent)
+	}
+	if r.Extra["logger"] != "http.log.access.log0" {
+		t.Errorf("Unexpected extras %v", r.Extra)
+	}
+}
+
+func TestProxyParserErrors(t *testing.T) {
+	for _, p := range []Parser{HAProxyParser{}, EnvoyParser{}, CaddyParser{}} {
+		for _, line := range []string{"", combinedLine, albLine} {
+			if _, err := p.Parse(line); err == nil {
+				t.Errorf("Expected %s to reject %q", p.Name(), line)
+			}
+		}
+	}
+}
+
+func TestDetectProxyParsers(t *testing.T) {
+	for name, line := range map[string]string{"haproxy": haproxyLine, "envoy": envoyLine, "caddy": caddyLine} {
+		p, err := DetectParser([]string{line})
+		if err != nil || p.Name() != name {
+			t.Errorf("Expected to detect %s but got %v (%v)", name, p, err)
+		}
+	}
+}
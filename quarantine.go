@@ -0,0 +1,301 @@
+package monitor
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultQuarantineMaxSize is the size a quarantine file may grow to before
+	// it is rotated.
+	DefaultQuarantineMaxSize = 10 << 20
+	// DefaultQuarantineBackups is how many rotated quarantine files are kept.
+	DefaultQuarantineBackups = 3
+	// DefaultFailureWarningRatio is the share of lines that may be rejected
+	// before a warning is raised.
+	DefaultFailureWarningRatio = 0.1
+	// DefaultFailureWindow is how many of the most recent lines the failure
+	// ratio is worked out over.
+	DefaultFailureWindow = 1000
+)
+
+// QuarantinedLine is a rejected line, as written to the quarantine file.
+type QuarantinedLine struct {
+	Time     time.Time `json:"time"`
+	Source   string    `json:"source,omitempty"`
+	Offset   int64     `json:"offset"`
+	Category string    `json:"category"`
+	Error    string    `json:"error"`
+	Line     string    `json:"line"`
+}
+
+// errorCategories names the category of each kind of parse error.
+var errorCategories = []struct {
+	err      error
+	category string
+}{
+	{ErrMissingHeader, "missing_header"},
+	{ErrMalformedRequest, "bad_request"},
+	{ErrMissingURL, "missing_url"},
+	{ErrMissingTime, "missing_time"},
+	{ErrInvalidValue, "invalid_value"},
+	{ErrUnterminated, "unterminated"},
+	{ErrFieldCount, "field_count"},
+	{ErrFormatMismatch, "format_mismatch"},
+}
+
+// ErrorCategory returns the category a parse error is counted under, or
+// "other" when it is not one of the kinds parsers return.
+func ErrorCategory(err error) string {
+	for _, c := range errorCategories {
+		if errors.Is(err, c.err) {
+			return c.category
+		}
+	}
+	return "other"
+}
+
+// Quarantine keeps the lines that could not be processed. Each of them is
+// appended to a file as a JSON object, and the file is rotated like a log, to
+// name.1, name.2 and so on, when it grows past its maximum size. Rejections
+// are counted by category, and a warning is printed when the share of the
+// most recent lines that were rejected goes above the warning ratio.
+type Quarantine struct {
+	mu         sync.Mutex
+	fileName   string
+	maxSize    int64
+	maxBackups int
+	file       *os.File
+	size       int64
+
+	counts   map[string]int64
+	accepted int64
+	rejected int64
+
+	warnRatio float64
+	window    []bool // Whether each recent line was rejected, as a ring
+	next      int
+	seen      int
+	failures  int
+	warning   bool
+}
+
+// NewQuarantine opens a quarantine file, appending to it if it exists. It is
+// rotated when it reaches maxSize bytes and maxBackups old files are kept.
+func NewQuarantine(fileName string, maxSize int64, maxBackups int) (*Quarantine, error) {
+	q := new(Quarantine)
+	q.fileName = fileName
+	q.maxSize = maxSize
+	q.maxBackups = maxBackups
+	q.counts = make(map[string]int64)
+	q.SetWarningLevel(DefaultFailureWarningRatio, DefaultFailureWindow)
+	if err := q.open(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+// SetWarningLevel sets the failure ratio above which a warning is raised and
+// the number of most recent lines it is worked out over. No warning is raised
+// until that many lines have been seen.
+func (q *Quarantine) SetWarningLevel(ratio float64, window int) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.warnRatio = ratio
+	q.window = make([]bool, window)
+	q.next, q.seen, q.failures = 0, 0, 0
+	q.warning = false
+}
+
+func (q *Quarantine) open() error {
+	f, err := os.OpenFile(q.fileName, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	q.file = f
+	q.size = info.Size()
+	return nil
+}
+
+// rotate moves the current file to name.1, shifting older ones along and
+// dropping the oldest, and starts a new one.
+func (q *Quarantine) rotate() error {
+	if err := q.file.Close(); err != nil {
+		return err
+	}
+	os.Remove(q.fileName + "." + strconv.Itoa(q.maxBackups))
+	for i := q.maxBackups - 1; i > 0; i-- {
+		os.Rename(q.fileName+"."+strconv.Itoa(i), q.fileName+"."+strconv.Itoa(i+1))
+	}
+	if q.maxBackups > 0 {
+		if err := os.Rename(q.fileName, q.fileName+".1"); err != nil {
+			return err
+		}
+	} else if err := os.Remove(q.fileName); err != nil {
+		return err
+	}
+	return q.open()
+}
+
+// Accept records that a line was processed successfully.
+func (q *Quarantine) Accept() {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.accepted++
+	q.observe(false)
+}
+
+// Reject writes a line that could not be processed to the quarantine file,
+// along with why and where it came from. offset is the line's position in
+// source, or -1 when it is not known.
+func (q *Quarantine) Reject(source string, offset int64, line string, reason error) error {
+	entry := QuarantinedLine{
+		Time:     time.Now(),
+		Source:   source,
+		Offset:   offset,
+		Category: ErrorCategory(reason),
+		Error:    reason.Error(),
+		Line:     line,
+	}
+	b, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	b = append(b, '\n')
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.rejected++
+	q.counts[entry.Category]++
+	q.observe(true)
+
+	if q.size > 0 && q.size+int64(len(b)) > q.maxSize {
+		if err := q.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := q.file.Write(b)
+	q.size += int64(n)
+	return err
+}
+
+// observe adds a line to the failure window and raises or clears the warning.
+func (q *Quarantine) observe(rejected bool) {
+	if len(q.window) == 0 {
+		return
+	}
+	if q.seen == len(q.window) && q.window[q.next] {
+		q.failures--
+	}
+	q.window[q.next] = rejected
+	q.next = (q.next + 1) % len(q.window)
+	if q.seen < len(q.window) {
+		q.seen++
+	}
+	if rejected {
+		q.failures++
+	}
+	if q.seen < len(q.window) {
+		return
+	}
+
+	ratio := float64(q.failures) / float64(q.seen)
+	if ratio > q.warnRatio && !q.warning {
+		fmt.Printf("PARSE FAILURES AT %.1f%% OF RECENT LINES, CHECK THE LOG FORMAT!!\n", ratio*100)
+		q.warning = true
+	}
+	if ratio <= q.warnRatio && q.warning {
+		fmt.Println("PARSE FAILURES RETURNING TO NORMAL!!")
+		q.warning = false
+	}
+}
+
+// Warning reports whether the failure ratio is currently above the warning
+// ratio.
+func (q *Quarantine) Warning() bool {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.warning
+}
+
+// FailureRatio returns the share of the most recent lines that were rejected.
+func (q *Quarantine) FailureRatio() float64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.seen == 0 {
+		return 0
+	}
+	return float64(q.failures) / float64(q.seen)
+}
+
+// Totals returns how many lines have been accepted and rejected in all.
+func (q *Quarantine) Totals() (accepted int64, rejected int64) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.accepted, q.rejected
+}
+
+// Categories returns the number of rejected lines in each error category, most
+// common first.
+func (q *Quarantine) Categories() []NamedCount {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return topCounts(q.counts, len(q.counts))
+}
+
+// Close closes the quarantine file.
+func (q *Quarantine) Close() error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return q.file.Close()
+}
+
+// SetQuarantine sets where ProcessEntry sends the lines it can not process.
+func (stats *LogStats) SetQuarantine(q *Quarantine) {
+	stats.quarantine = q
+}
+
+// ProcessEntryAt processes a log entry like ProcessEntry, saying where it came
+// from in case it has to be quarantined. offset is the entry's position in
+// source, or -1 when it is not known.
+func (stats *LogStats) ProcessEntryAt(source string, offset int64, e *string) error {
+	var err error
+	if fast, ok := stats.parser.(*FastParser); ok {
+		err = stats.processFast(fast, *e)
+	} else {
+		var r *AccessRecord
+		r, err = stats.Parser().Parse(*e)
+		if errors.Is(err, ErrHeaderLine) {
+			return nil
+		} else if err == nil {
+			err = stats.ProcessRecord(r)
+		}
+	}
+
+	stats.quarantine.report(source, offset, *e, err)
+	return err
+}
+
+// report accepts the line when err is nil and rejects it otherwise. It does
+// nothing when q is nil.
+func (q *Quarantine) report(source string, offset int64, line string, err error) {
+	if q == nil {
+		return
+	}
+	if err == nil {
+		q.Accept()
+	} else if qerr := q.Reject(source, offset, line, err); qerr != nil {
+		log.Println("Failed to quarantine log entry: ", qerr)
+	}
+}
@@ -0,0 +1,206 @@
+package monitor
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readQuarantine(t *testing.T, fName string) []QuarantinedLine {
+	f, err := os.Open(fName)
+	if err != nil {
+		t.Errorf("Failed to open the quarantine file! %s", err)
+		t.FailNow()
+	}
+	defer f.Close()
+	var lines []QuarantinedLine
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var q QuarantinedLine
+		if err := json.Unmarshal(scanner.Bytes(), &q); err != nil {
+			t.Errorf("Failed to decode %s! %s", scanner.Text(), err)
+		}
+		lines = append(lines, q)
+	}
+	return lines
+}
+
+func TestQuarantineReject(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "rejected.log")
+	q, err := NewQuarantine(fName, DefaultQuarantineMaxSize, DefaultQuarantineBackups)
+	if err != nil {
+		t.Errorf("Failed to create the quarantine! %s", err)
+		t.FailNow()
+	}
+	defer q.Close()
+
+	_, perr := CombinedParser{}.Parse(`127.0.0.1 - - [09/May/2018:16:00:39 +0000] "GET /x HTTP/1.0" 200`)
+	q.Reject("access.log", 42, "bad line", perr)
+	nginx, _ := CompileNginxFormat("main", `$remote_addr [$time_local] "$request"`, "")
+	_, perr = nginx.Parse("worse line")
+	q.Reject("access.log", 52, "worse line", perr)
+	q.Reject("", -1, "odd line", errors.New("Something else"))
+	q.Accept()
+
+	lines := readQuarantine(t, fName)
+	if len(lines) != 3 {
+		t.Errorf("Expected 3 quarantined lines but got %d", len(lines))
+		t.FailNow()
+	}
+	if lines[0].Source != "access.log" || lines[0].Offset != 42 || lines[0].Line != "bad line" || lines[0].Category != "field_count" {
+		t.Errorf("Unexpected quarantined line %+v", lines[0])
+	}
+	if lines[1].Category != "format_mismatch" || lines[2].Category != "other" || lines[2].Offset != -1 {
+		t.Errorf("Unexpected categories %s and %s", lines[1].Category, lines[2].Category)
+	}
+
+	accepted, rejected := q.Totals()
+	if accepted != 1 || rejected != 3 {
+		t.Errorf("Expected 1 accepted and 3 rejected but got %d and %d", accepted, rejected)
+	}
+	if len(q.Categories()) != 3 || q.Categories()[0].Count != 1 {
+		t.Errorf("Unexpected categories %v", q.Categories())
+	}
+}
+
+func TestQuarantineRotation(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "rejected.log")
+	q, err := NewQuarantine(fName, 300, 2)
+	if err != nil {
+		t.Errorf("Failed to create the quarantine! %s", err)
+		t.FailNow()
+	}
+	defer q.Close()
+
+	for i := 0; i < 10; i++ {
+		if err := q.Reject("access.log", int64(i), "a line that could not be parsed", errors.New("Invalid value")); err != nil {
+			t.Errorf("Failed to quarantine a line! %s", err)
+		}
+	}
+	for _, name := range []string{fName, fName + ".1", fName + ".2"} {
+		info, err := os.Stat(name)
+		if err != nil {
+			t.Errorf("Expected %s to exist! %s", name, err)
+		} else if info.Size() > 300 {
+			t.Errorf("Expected %s to be at most 300 bytes but it is %d", name, info.Size())
+		}
+	}
+	if _, err := os.Stat(fName + ".3"); !os.IsNotExist(err) {
+		t.Errorf("Expected only 2 rotated files to be kept!")
+	}
+	lines := readQuarantine(t, fName)
+	if len(lines) == 0 || lines[len(lines)-1].Offset != 9 {
+		t.Errorf("Expected the latest line in the current file but got %+v", lines)
+	}
+}
+
+func TestQuarantineWarning(t *testing.T) {
+	q, err := NewQuarantine(filepath.Join(t.TempDir(), "rejected.log"), DefaultQuarantineMaxSize, 0)
+	if err != nil {
+		t.Errorf("Failed to create the quarantine! %s", err)
+		t.FailNow()
+	}
+	defer q.Close()
+	q.SetWarningLevel(0.25, 4)
+
+	reason := errors.New("Invalid value")
+	q.Reject("", -1, "bad", reason)
+	q.Reject("", -1, "bad", reason)
+	if q.Warning() {
+		t.Errorf("Expected no warning before the window is full!")
+	}
+	q.Accept()
+	q.Accept()
+	if !q.Warning() || q.FailureRatio() != 0.5 {
+		t.Errorf("Expected a warning at a ratio of 0.5 but got %f", q.FailureRatio())
+	}
+	q.Accept()
+	if q.Warning() || q.FailureRatio() != 0.25 {
+		t.Errorf("Expected the warning to clear at a ratio of 0.25 but got %f", q.FailureRatio())
+	}
+}
+
+func TestLogStatsQuarantine(t *testing.T) {
+	fName := filepath.Join(t.TempDir(), "rejected.log")
+	q, err := NewQuarantine(fName, DefaultQuarantineMaxSize, DefaultQuarantineBackups)
+	if err != nil {
+		t.Errorf("Failed to create the quarantine! %s", err)
+		t.FailNow()
+	}
+	defer q.Close()
+
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetQuarantine(q)
+	good := `127.0.0.1 - - [09/May/2018:16:00:39 +0000] "GET http://my.site.com/pages/create HTTP/1.0" 200 100`
+	bad := "garbage"
+	if err := stats.ProcessEntry(&good); err != nil {
+		t.Errorf("Failed to process log entry! %s", err)
+	}
+	if err := stats.ProcessEntryAt("access.log", 120, &bad); err == nil {
+		t.Errorf("Expected an error for a malformed entry!")
+	}
+
+	lines := readQuarantine(t, fName)
+	if len(lines) != 1 || lines[0].Line != bad || lines[0].Source != "access.log" || lines[0].Offset != 120 {
+		t.Errorf("Unexpected quarantined lines %+v", lines)
+	}
+	if accepted, rejected := q.Totals(); accepted != 1 || rejected != 1 {
+		t.Errorf("Expected 1 accepted and 1 rejected but got %d and %d", accepted, rejected)
+	}
+}
+
+func TestProcessSourceQuarantine(t *testing.T) {
+	dir := t.TempDir()
+	q, err := NewQuarantine(filepath.Join(dir, "rejected.log"), DefaultQuarantineMaxSize, DefaultQuarantineBackups)
+	if err != nil {
+		t.Errorf("Failed to create the quarantine! %s", err)
+		t.FailNow()
+	}
+	defer q.Close()
+
+	fName := filepath.Join(dir, "access.log")
+	good := `127.0.0.1 - - [09/May/2018:16:00:39 +0000] "GET http://my.site.com/pages/create HTTP/1.0" 200 100`
+	writeLines(t, fName, good, "garbage")
+
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetQuarantine(q)
+	r := NewLogReader(fName)
+	defer r.Close()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	stats.ProcessSource(ctx, r, time.Millisecond)
+
+	lines := readQuarantine(t, filepath.Join(dir, "rejected.log"))
+	if len(lines) != 1 || lines[0].Source != fName || lines[0].Offset != int64(len(good)+1) {
+		t.Errorf("Expected the line to be quarantined with its file and offset but got %+v", lines)
+	}
+}
+
+func TestErrorCategory(t *testing.T) {
+	json, _ := NewJSONParser("app", testJSONMapping)
+	record, _ := json.Parse(`{"request": {"uri": "http://my.site.com/"}}`)
+	tests := map[string]error{
+		"unterminated":    parseError(CombinedParser{}, `127.0.0.1 - - [09/May/2018:16:00:39 +0000 "GET /x HTTP/1.0" 200 1`),
+		"invalid_value":   parseError(CombinedParser{}, `127.0.0.1 - - [09/May/2018:16:00:39 +0000] "GET /x HTTP/1.0" ok 1 "-" "-"`),
+		"bad_request":     parseError(CombinedParser{}, `127.0.0.1 - - [09/May/2018:16:00:39 +0000] "GET" 200 1 "-" "-"`),
+		"missing_header":  parseError(NewW3CParser(time.Millisecond), "2026-10-16 08:00:01 GET /x - 200 4"),
+		"format_mismatch": parseError(CommonParser{}, "garbage"),
+		"missing_time":    NewLogStatsDefault("my.site.com").ProcessRecord(record),
+		"other":           errors.New("Something else"),
+	}
+	for expected, err := range tests {
+		if actual := ErrorCategory(err); actual != expected {
+			t.Errorf("Expected %s for %v but got %s", expected, err, actual)
+		}
+	}
+}
+
+func parseError(p Parser, line string) error {
+	_, err := p.Parse(line)
+	return err
+}
@@ -0,0 +1,335 @@
+package monitor
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// maxSyslogMessage is the largest syslog message accepted over any transport.
+const maxSyslogMessage = 64 * 1024
+
+// ParseSyslogMessage strips the RFC 5424 or RFC 3164 envelope from a syslog
+// message and returns the message body, which for nginx's syslog output is the
+// access log line.
+func ParseSyslogMessage(msg string) (string, error) {
+	msg = strings.TrimRight(msg, "\r\n\x00")
+	if !strings.HasPrefix(msg, "<") {
+		return "", errors.New("Syslog message has no priority: " + msg)
+	}
+	end := strings.IndexByte(msg, '>')
+	if end < 2 || end > 4 {
+		return "", errors.New("Syslog message has a malformed priority: " + msg)
+	}
+	if _, err := strconv.Atoi(msg[1:end]); err != nil {
+		return "", errors.New("Syslog message has a malformed priority: " + msg)
+	}
+	rest := msg[end+1:]
+	if strings.HasPrefix(rest, "1 ") {
+		return parseRFC5424(rest[2:])
+	}
+	return parseRFC3164(rest), nil
+}
+
+// parseRFC5424 skips TIMESTAMP HOSTNAME APP-NAME PROCID MSGID STRUCTURED-DATA.
+func parseRFC5424(rest string) (string, error) {
+	for i := 0; i < 5; i++ {
+		sp := strings.IndexByte(rest, ' ')
+		if sp < 0 {
+			return "", errors.New("RFC 5424 syslog message is missing its header fields")
+		}
+		rest = rest[sp+1:]
+	}
+
+	if strings.HasPrefix(rest, "-") {
+		rest = rest[1:]
+	} else {
+		for strings.HasPrefix(rest, "[") {
+			i := 1
+			for ; i < len(rest) && rest[i] != ']'; i++ {
+				if rest[i] == '\\' {
+					i++
+				}
+			}
+			if i >= len(rest) {
+				return "", errors.New("RFC 5424 syslog message has unterminated structured data")
+			}
+			rest = rest[i+1:]
+		}
+	}
+	rest = strings.TrimPrefix(rest, " ")
+	return strings.TrimPrefix(rest, "\ufeff"), nil
+}
+
+// parseRFC3164 skips the "Mmm dd hh:mm:ss" timestamp and, when present, the
+// hostname and the "tag:" or "tag[pid]:" that nginx and most daemons send.
+func parseRFC3164(rest string) string {
+	const stamp = len("Jan _2 15:04:05 ")
+	if len(rest) >= stamp && rest[3] == ' ' && rest[6] == ' ' && rest[9] == ':' && rest[12] == ':' {
+		rest = rest[stamp:]
+	}
+	fields := strings.SplitN(rest, " ", 3)
+	if len(fields) > 1 && strings.HasSuffix(fields[0], ":") {
+		return strings.TrimPrefix(rest, fields[0]+" ")
+	}
+	if len(fields) > 2 && strings.HasSuffix(fields[1], ":") {
+		return fields[2]
+	}
+	// Neither a hostname and tag nor a tag on its own, it is all message.
+	return rest
+}
+
+// SyslogReceiver listens for syslog messages over any number of UDP, TCP and
+// Unix datagram sockets and makes their bodies available as a LogSource.
+// Messages that are not valid syslog are logged and dropped.
+type SyslogReceiver struct {
+	lines     chan string
+	done      chan struct{}
+	once      sync.Once
+	wg        sync.WaitGroup
+	mu        sync.Mutex
+	listeners []io.Closer
+	conns     map[net.Conn]struct{} // Open TCP connections
+}
+
+// NewSyslogReceiver constructs a receiver that is not listening anywhere yet.
+func NewSyslogReceiver() *SyslogReceiver {
+	s := new(SyslogReceiver)
+	s.lines = make(chan string, readerSourceBuffer)
+	s.done = make(chan struct{})
+	s.conns = make(map[net.Conn]struct{})
+	return s
+}
+
+// ListenUDP receives one syslog message per datagram on addr, such as
+// "0.0.0.0:514". It returns the address actually listened on.
+func (s *SyslogReceiver) ListenUDP(addr string) (net.Addr, error) {
+	conn, err := net.ListenPacket("udp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.track(conn)
+	s.wg.Add(1)
+	go s.receivePackets(conn)
+	return conn.LocalAddr(), nil
+}
+
+// ListenUnixgram receives one syslog message per datagram on the Unix socket
+// at path, which is created and removed again on Close.
+func (s *SyslogReceiver) ListenUnixgram(path string) error {
+	conn, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		return err
+	}
+	s.track(conn)
+	s.wg.Add(1)
+	go s.receivePackets(conn)
+	return nil
+}
+
+// ListenTCP accepts syslog connections on addr. Each connection may use either
+// octet counting or newline framing (RFC 6587).
+func (s *SyslogReceiver) ListenTCP(addr string) (net.Addr, error) {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	s.track(l)
+	s.wg.Add(1)
+	go func() {
+		defer s.wg.Done()
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			if !s.trackConn(conn) {
+				return
+			}
+			s.wg.Add(1)
+			go s.receiveStream(conn)
+		}
+	}()
+	return l.Addr(), nil
+}
+
+func (s *SyslogReceiver) track(c io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		c.Close()
+	default:
+		s.listeners = append(s.listeners, c)
+	}
+}
+
+// trackConn remembers an accepted connection until its receive loop ends. It
+// closes the connection and returns false if the receiver is already closed.
+func (s *SyslogReceiver) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	select {
+	case <-s.done:
+		conn.Close()
+		return false
+	default:
+		s.conns[conn] = struct{}{}
+		return true
+	}
+}
+
+func (s *SyslogReceiver) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.conns, conn)
+}
+
+func (s *SyslogReceiver) receivePackets(conn net.PacketConn) {
+	defer s.wg.Done()
+	buf := make([]byte, maxSyslogMessage)
+	for {
+		n, _, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		if !s.deliver(string(buf[:n])) {
+			return
+		}
+	}
+}
+
+func (s *SyslogReceiver) receiveStream(conn net.Conn) {
+	defer s.wg.Done()
+	defer s.untrackConn(conn)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	for {
+		msg, err := readFramedMessage(reader)
+		if err != nil {
+			if err != io.EOF {
+				log.Println("Dropping syslog connection from ", conn.RemoteAddr(), ": ", err)
+			}
+			return
+		}
+		if !s.deliver(msg) {
+			return
+		}
+	}
+}
+
+// readFramedMessage reads one octet counted ("LEN SP MSG") or newline
+// terminated message. Neither the message nor its count is read any further
+// than maxSyslogMessage allows.
+func readFramedMessage(reader *bufio.Reader) (string, error) {
+	first, err := reader.Peek(1)
+	if err != nil {
+		return "", err
+	}
+	if first[0] < '0' || first[0] > '9' {
+		var line []byte
+		for {
+			chunk, err := reader.ReadSlice('\n')
+			// The newline does not count towards the message.
+			if len(line)+len(chunk) > maxSyslogMessage+1 {
+				return "", errors.New("Syslog message is longer than " + strconv.Itoa(maxSyslogMessage) + " bytes")
+			}
+			line = append(line, chunk...)
+			if err == bufio.ErrBufferFull {
+				continue
+			}
+			if err == io.EOF && len(line) > 0 {
+				err = nil
+			}
+			return string(line), err
+		}
+	}
+
+	var count []byte
+	for {
+		c, err := reader.ReadByte()
+		if err != nil {
+			return "", err
+		}
+		if c == ' ' {
+			break
+		}
+		count = append(count, c)
+		if len(count) > len(strconv.Itoa(maxSyslogMessage)) {
+			return "", errors.New("Invalid syslog octet count " + string(count))
+		}
+	}
+	n, err := strconv.Atoi(string(count))
+	if err != nil || n <= 0 || n > maxSyslogMessage {
+		return "", errors.New("Invalid syslog octet count " + string(count))
+	}
+	buf := make([]byte, n)
+	if _, err := io.ReadFull(reader, buf); err != nil {
+		return "", err
+	}
+	return string(buf), nil
+}
+
+// deliver queues the body of msg. It returns false once the receiver is closed.
+func (s *SyslogReceiver) deliver(msg string) bool {
+	body, err := ParseSyslogMessage(msg)
+	if err != nil {
+		log.Println("Dropping syslog message: ", err)
+		return true
+	}
+	select {
+	case s.lines <- body:
+		return true
+	case <-s.done:
+		return false
+	}
+}
+
+// GetNewLogEntries returns the message bodies received since the last call. It
+// returns io.EOF once the receiver has been closed.
+func (s *SyslogReceiver) GetNewLogEntries() ([]string, error) {
+	var entries []string
+	for len(entries) < readerSourceBuffer {
+		select {
+		case line := <-s.lines:
+			entries = append(entries, line)
+		default:
+			select {
+			case <-s.done:
+				return entries, io.EOF
+			default:
+				return entries, nil
+			}
+		}
+	}
+	return entries, nil
+}
+
+// Close stops listening, closes every connection and waits for them to finish.
+func (s *SyslogReceiver) Close() error {
+	var err error
+	s.once.Do(func() {
+		s.mu.Lock()
+		close(s.done)
+		for _, l := range s.listeners {
+			if cerr := l.Close(); cerr != nil && err == nil {
+				err = cerr
+			}
+			if c, ok := l.(net.PacketConn); ok && c.LocalAddr().Network() == "unixgram" {
+				os.Remove(c.LocalAddr().String())
+			}
+		}
+		for conn := range s.conns {
+			conn.Close()
+		}
+		s.mu.Unlock()
+		s.wg.Wait()
+	})
+	return err
+}
@@ -0,0 +1,185 @@
+package monitor
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+const syslogAccessLine = `127.0.0.1 user-identifier frank [10/Oct/2000:13:55:36 -0700] "GET http://my.site.com/pages/create HTTP/1.0" 200 2326`
+
+func TestParseSyslogMessage(t *testing.T) {
+	tests := map[string]string{
+		"<190>Oct 16 08:00:00 web1 nginx: " + syslogAccessLine:                                   syslogAccessLine,
+		"<190>Oct  6 08:00:00 nginx[123]: " + syslogAccessLine + "\n":                            syslogAccessLine,
+		"<190>Oct 16 08:00:00 " + syslogAccessLine:                                               syslogAccessLine,
+		"<190>1 2026-10-16T08:00:00.000Z web1 nginx 123 - - " + syslogAccessLine:                 syslogAccessLine,
+		`<190>1 2026-10-16T08:00:00Z web1 nginx - access [meta a="x\]y"][b c="d"] ` + "\ufeffhi": "hi",
+	}
+	for msg, expected := range tests {
+		actual, err := ParseSyslogMessage(msg)
+		if err != nil {
+			t.Errorf("Failed to parse %q! %s", msg, err)
+			continue
+		}
+		if expected != actual {
+			t.Errorf("Expected %q from %q but got %q instead.", expected, msg, actual)
+		}
+	}
+
+	for _, msg := range []string{"no priority", "<abc>Oct 16 08:00:00 x", "<1>1 too short", `<1>1 a b c d e [unterminated`} {
+		if _, err := ParseSyslogMessage(msg); err == nil {
+			t.Errorf("Expected an error for %q!", msg)
+		}
+	}
+}
+
+func waitForEntries(t *testing.T, src LogSource, n int) []string {
+	var all []string
+	deadline := time.Now().Add(5 * time.Second)
+	for len(all) < n && time.Now().Before(deadline) {
+		entries, err := src.GetNewLogEntries()
+		if err != nil {
+			t.Errorf("Unexpected error from the source! %s", err)
+			return all
+		}
+		all = append(all, entries...)
+		time.Sleep(time.Millisecond)
+	}
+	if len(all) != n {
+		t.Errorf("Expected %d entries but got %v", n, all)
+	}
+	return all
+}
+
+func TestSyslogReceiverUDP(t *testing.T) {
+	s := NewSyslogReceiver()
+	defer s.Close()
+	addr, err := s.ListenUDP("127.0.0.1:0")
+	if err != nil {
+		t.Errorf("Failed to listen! %s", err)
+		t.FailNow()
+	}
+
+	conn, _ := net.Dial("udp", addr.String())
+	defer conn.Close()
+	conn.Write([]byte("not syslog"))
+	conn.Write([]byte("<190>Oct 16 08:00:00 web1 nginx: " + syslogAccessLine))
+
+	entries := waitForEntries(t, s, 1)
+	if len(entries) == 1 && entries[0] != syslogAccessLine {
+		t.Errorf("Expected %s but got %s instead.", syslogAccessLine, entries[0])
+	}
+}
+
+func TestSyslogReceiverTCP(t *testing.T) {
+	s := NewSyslogReceiver()
+	defer s.Close()
+	addr, err := s.ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Errorf("Failed to listen! %s", err)
+		t.FailNow()
+	}
+
+	newline := "<190>Oct 16 08:00:00 web1 nginx: one\n"
+	counted := "<190>1 2026-10-16T08:00:00Z web1 nginx - - - two\nlines"
+	conn, _ := net.Dial("tcp", addr.String())
+	fmt.Fprintf(conn, "%s%d %s", newline, len(counted), counted)
+	conn.Close()
+
+	entries := waitForEntries(t, s, 2)
+	if len(entries) == 2 && (entries[0] != "one" || entries[1] != "two\nlines") {
+		t.Errorf("Expected [one two\\nlines] but got %q", entries)
+	}
+}
+
+func TestSyslogReceiverForgetsClosedConnections(t *testing.T) {
+	s := NewSyslogReceiver()
+	defer s.Close()
+	addr, err := s.ListenTCP("127.0.0.1:0")
+	if err != nil {
+		t.Errorf("Failed to listen! %s", err)
+		t.FailNow()
+	}
+	for i := 0; i < 5; i++ {
+		conn, _ := net.Dial("tcp", addr.String())
+		fmt.Fprintf(conn, "<190>Oct 16 08:00:00 web1 nginx: line %d\n", i)
+		conn.Close()
+	}
+	waitForEntries(t, s, 5)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		s.mu.Lock()
+		open := len(s.conns)
+		s.mu.Unlock()
+		if open == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Errorf("Expected closed connections to be forgotten but %d are still tracked", open)
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	s.mu.Lock()
+	if len(s.listeners) != 1 {
+		t.Errorf("Expected only the listener to be tracked but got %d", len(s.listeners))
+	}
+	s.mu.Unlock()
+}
+
+func TestSyslogReceiverUnixgram(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "syslog.sock")
+	s := NewSyslogReceiver()
+	if err := s.ListenUnixgram(path); err != nil {
+		t.Skipf("Unix datagram sockets are not available: %s", err)
+	}
+
+	conn, err := net.Dial("unixgram", path)
+	if err != nil {
+		t.Errorf("Failed to connect! %s", err)
+		t.FailNow()
+	}
+	conn.Write([]byte("<190>Oct 16 08:00:00 web1 nginx: " + syslogAccessLine))
+	conn.Close()
+
+	stats := NewLogStatsDefault("my.site.com")
+	for _, e := range waitForEntries(t, s, 1) {
+		if err := stats.ProcessEntry(&e); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if stats.TotalSiteRequests() != 1 {
+		t.Errorf("Expected 1 request but got %d instead.", stats.TotalSiteRequests())
+	}
+
+	s.Close()
+	if _, err := s.GetNewLogEntries(); err == nil {
+		t.Errorf("A closed receiver should report that it has ended!")
+	}
+}
+
+func TestReadFramedMessageLimits(t *testing.T) {
+	for name, input := range map[string]string{
+		"endless line":  strings.Repeat("a", maxSyslogMessage+2),
+		"endless count": strings.Repeat("1", 100),
+	} {
+		if _, err := readFramedMessage(bufio.NewReader(strings.NewReader(input))); err == nil || err == io.EOF {
+			t.Errorf("Expected the %s to be refused but got %v", name, err)
+		}
+	}
+
+	line := strings.Repeat("a", maxSyslogMessage) + "\n"
+	if msg, err := readFramedMessage(bufio.NewReader(strings.NewReader(line))); err != nil || msg != line {
+		t.Errorf("Expected a message of the maximum length to be read but got %d bytes (%v)", len(msg), err)
+	}
+	if msg, err := readFramedMessage(bufio.NewReader(strings.NewReader("5 hello"))); err != nil || msg != "hello" {
+		t.Errorf("Expected an octet counted message but got %q (%v)", msg, err)
+	}
+}
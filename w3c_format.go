@@ -0,0 +1,163 @@
+package monitor
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// iisDefaultFields are the fields IIS logs when its W3C logging is left at the
+// defaults, used until a "#Fields:" directive is read.
+var iisDefaultFields = []string{
+	"date", "time", "s-ip", "cs-method", "cs-uri-stem", "cs-uri-query", "s-port",
+	"cs-username", "c-ip", "cs(User-Agent)", "cs(Referer)", "sc-status",
+	"sc-substatus", "sc-win32-status", "time-taken",
+}
+
+var w3cFields = map[string]recordField{
+	"timestamp":      fieldTimeISO8601,
+	"c-ip":           fieldClient,
+	"cs-method":      fieldMethod,
+	"cs-uri-stem":    fieldURI,
+	"cs-uri":         fieldURI,
+	"cs-host":        fieldHostHeader,
+	"x-host-header":  fieldHostHeader,
+	"cs(Host)":       fieldServerName,
+	"sc-status":      fieldStatus,
+	"sc-bytes":       fieldBytes,
+	"cs(Referer)":    fieldReferer,
+	"cs(User-Agent)": fieldUserAgent,
+}
+
+// W3CParser parses W3C extended logs, as written by IIS among others. The
+// columns are taken from the most recent "#Fields:" directive, so a log whose
+// fields change partway through is parsed correctly as long as its lines are
+// given to Parse in order. Directive lines return ErrHeaderLine. Fields without
+// a counterpart in AccessRecord are kept in Extra under their W3C name.
+type W3CParser struct {
+	mu         sync.Mutex
+	name       string
+	timeTaken  time.Duration
+	plusSpaces bool
+	fields     []string
+	date       string // From the last "#Date:" directive, for logs without a date field
+}
+
+// NewW3CParser constructs a parser that reads time-taken in the given unit. The
+// W3C draft uses seconds. Lines are rejected until a "#Fields:" directive is
+// read.
+func NewW3CParser(timeTaken time.Duration) *W3CParser {
+	p := new(W3CParser)
+	p.name = "w3c"
+	p.timeTaken = timeTaken
+	return p
+}
+
+// NewIISParser constructs a W3CParser for IIS logs, which record time-taken in
+// milliseconds and replace spaces with "+". Until a "#Fields:" directive is
+// read, lines are expected to have IIS's default fields.
+func NewIISParser() *W3CParser {
+	p := NewW3CParser(time.Millisecond)
+	p.name = "iis"
+	p.plusSpaces = true
+	p.fields = iisDefaultFields
+	return p
+}
+
+// Name implements Parser.
+func (p *W3CParser) Name() string {
+	return p.name
+}
+
+// Fields returns the fields of the lines currently being parsed.
+func (p *W3CParser) Fields() []string {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.fields
+}
+
+// Parse implements Parser.
+func (p *W3CParser) Parse(line string) (*AccessRecord, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if strings.HasPrefix(line, "#") {
+		directive, value, _ := strings.Cut(line[1:], ":")
+		switch directive {
+		case "Fields":
+			p.fields = strings.Fields(value)
+		case "Date":
+			p.date, _, _ = strings.Cut(strings.TrimSpace(value), " ")
+		}
+		return nil, ErrHeaderLine
+	}
+	if len(p.fields) == 0 {
+		return nil, fmt.Errorf("%w before line: %s", ErrMissingHeader, line)
+	}
+
+	var values []string
+	if strings.Contains(line, "\t") {
+		values = strings.Split(line, "\t")
+	} else {
+		values = strings.Fields(line)
+	}
+	if len(values) != len(p.fields) {
+		return nil, fmt.Errorf("%w: expected %d but got %d in log line: %s", ErrFieldCount, len(p.fields), len(values), line)
+	}
+	return w3cRecord(values, p.fields, p.date, p.timeTaken, p.plusSpaces)
+}
+
+// w3cRecord builds a record from the values of a W3C log line and the names of
+// their fields. date is used when the line has a time but no date.
+func w3cRecord(fields []string, names []string, date string, timeTaken time.Duration, plusSpaces bool) (*AccessRecord, error) {
+	values := make(map[string]string)
+	for i, name := range names {
+		if i < len(fields) {
+			values[name] = fields[i]
+		}
+	}
+
+	if d, ok := values["date"]; ok {
+		date = d
+	}
+	if t, ok := values["time"]; ok && date != "" {
+		values["timestamp"] = date + "T" + t + "Z"
+	}
+	delete(values, "date")
+	delete(values, "time")
+	if q := values["cs-uri-query"]; q != "-" && q != "" {
+		values["cs-uri-stem"] += "?" + q
+	}
+	delete(values, "cs-uri-query")
+	for _, name := range []string{"cs(Referer)", "cs(User-Agent)", "cs(Cookie)"} {
+		v, ok := values[name]
+		if !ok {
+			continue
+		}
+		if plusSpaces {
+			v = strings.ReplaceAll(v, "+", " ")
+		} else if u, err := url.PathUnescape(v); err == nil {
+			v = u
+		}
+		values[name] = v
+	}
+	taken, ok := values["time-taken"]
+	delete(values, "time-taken")
+
+	r := new(AccessRecord)
+	if err := fillFromVariables(r, values, w3cFields); err != nil {
+		return nil, err
+	}
+	if ok && taken != "-" {
+		n, err := strconv.ParseFloat(taken, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w %q in log line: %s", ErrInvalidValue, taken, err)
+		}
+		r.Duration = time.Duration(n * float64(timeTaken))
+		r.HasDuration = true
+	}
+	return r, nil
+}
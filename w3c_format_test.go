@@ -0,0 +1,117 @@
+package monitor
+
+import (
+	"testing"
+	"time"
+)
+
+func TestIISParser(t *testing.T) {
+	p := NewIISParser()
+	lines := []string{
+		"#Software: Microsoft Internet Information Services 10.0",
+		"#Version: 1.0",
+		"#Date: 2026-10-16 08:00:00",
+		"2026-10-16 08:00:01 10.0.0.5 GET /pages/a id=7 443 - 192.0.2.1 Mozilla/5.0+(Windows+NT+10.0) - 200 0 0 15",
+		"#Fields: date time cs-host cs-method cs-uri-stem cs-uri-query c-ip sc-status sc-bytes time-taken",
+		"2026-10-16 08:00:02 my.site.com POST /pages/b - 192.0.2.2 302 128 250",
+	}
+	var records []*AccessRecord
+	for _, line := range lines {
+		r, err := p.Parse(line)
+		if err == ErrHeaderLine {
+			continue
+		} else if err != nil {
+			t.Errorf("Failed to parse %q! %s", line, err)
+			t.FailNow()
+		}
+		records = append(records, r)
+	}
+	if len(records) != 2 {
+		t.Errorf("Expected 2 records but got %d", len(records))
+		t.FailNow()
+	}
+
+	r := records[0]
+	if !r.Time.Equal(time.Date(2026, 10, 16, 8, 0, 1, 0, time.UTC)) || r.Client != "192.0.2.1" {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if r.URL.Path != "/pages/a" || r.URL.RawQuery != "id=7" || r.UserAgent != "Mozilla/5.0 (Windows NT 10.0)" {
+		t.Errorf("Unexpected URL %s or user agent %q", r.URL, r.UserAgent)
+	}
+	if r.Status != 200 || r.Duration != 15*time.Millisecond || r.Extra["sc-substatus"] != "0" {
+		t.Errorf("Unexpected status %d, duration %s or extras %v", r.Status, r.Duration, r.Extra)
+	}
+
+	r = records[1]
+	if r.Host != "my.site.com" || r.Method != "POST" || r.URL.RawQuery != "" {
+		t.Errorf("Expected the new fields to be used but got %+v", r)
+	}
+	if r.Status != 302 || r.Bytes != 128 || r.Duration != 250*time.Millisecond {
+		t.Errorf("Unexpected status %d, bytes %d or duration %s", r.Status, r.Bytes, r.Duration)
+	}
+	if len(p.Fields()) != 10 {
+		t.Errorf("Expected the parser to use the latest fields but got %v", p.Fields())
+	}
+}
+
+func TestW3CParser(t *testing.T) {
+	p := NewW3CParser(time.Second)
+	if _, err := p.Parse("12:00:00 /pages/a 200"); err == nil {
+		t.Errorf("Expected an error before any #Fields directive!")
+	}
+	for _, line := range []string{"#Date: 2026-10-16 00:00:00", "#Fields: time cs-uri cs(User-Agent) time-taken"} {
+		if _, err := p.Parse(line); err != ErrHeaderLine {
+			t.Errorf("Expected ErrHeaderLine for %q but got %v", line, err)
+		}
+	}
+	r, err := p.Parse("12:00:00\thttp://my.site.com/pages/a\tcurl%2F8.0 x\t0.5")
+	if err != nil {
+		t.Errorf("Failed to parse the line! %s", err)
+		t.FailNow()
+	}
+	if !r.Time.Equal(time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)) {
+		t.Errorf("Expected the date from the #Date directive but got %s", r.Time)
+	}
+	if r.Host != "my.site.com" || r.UserAgent != "curl/8.0 x" || r.Duration != 500*time.Millisecond {
+		t.Errorf("Unexpected record %+v", r)
+	}
+	if _, err := p.Parse("12:00:00 /pages/a"); err == nil {
+		t.Errorf("Expected an error for a line with too few fields!")
+	}
+	if _, err := p.Parse("12:00:00 /pages/a - soon"); err == nil {
+		t.Errorf("Expected an error for an invalid time-taken!")
+	}
+}
+
+func TestLogStatsIISParser(t *testing.T) {
+	stats := NewLogStatsDefault("my.site.com")
+	stats.SetParser(NewIISParser())
+	for _, line := range []string{
+		"#Fields: date time cs-method cs-uri cs-uri-query sc-status time-taken",
+		"2026-10-16 08:00:01 GET http://my.site.com/pages/a - 200 4",
+		"2026-10-16 08:00:02 GET http://my.site.com/pages/b - 200 2",
+	} {
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if stats.TotalSiteRequests() != 2 {
+		t.Errorf("Expected 2 requests but got %d", stats.TotalSiteRequests())
+	}
+	if d := stats.PopularSections()[0].AverageDuration(); d != 3*time.Millisecond {
+		t.Errorf("Expected an average response time of 3ms but got %s", d)
+	}
+
+	// A time taken of zero is a fast request, not a missing one.
+	for _, line := range []string{
+		"2026-10-16 08:00:03 GET http://my.site.com/pages/c - 200 0",
+		"2026-10-16 08:00:04 GET http://my.site.com/pages/d - 200 -",
+	} {
+		if err := stats.ProcessEntry(&line); err != nil {
+			t.Errorf("Failed to process log entry! %s", err)
+		}
+	}
+	if d := stats.PopularSections()[0].AverageDuration(); d != 2*time.Millisecond {
+		t.Errorf("Expected an average response time of 2ms but got %s", d)
+	}
+}